@@ -0,0 +1,68 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/anupcshan/bazel-build-worker/cache"
+)
+
+// prewarmHandler serves /admin/prewarm. GET returns a manifest of the inputs this worker used most, POST takes a
+// manifest and fetches its entries into the DiskCache in the background.
+type prewarmHandler struct {
+	diskCache   *cache.DiskCache
+	concurrency int
+}
+
+func (ph *prewarmHandler) prewarm(source string, entries []cache.PrewarmEntry) {
+	log.Printf("Prewarming %d entries from %s", len(entries), source)
+	fetched, failed := ph.diskCache.Prewarm(entries, ph.concurrency)
+	log.Printf("Prewarming from %s done: %d fetched, %d failed, %d already cached", source, fetched, failed, len(entries)-fetched-failed)
+}
+
+func (ph *prewarmHandler) prewarmFromFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	entries, err := cache.ParsePrewarmManifest(f)
+	if err != nil {
+		return err
+	}
+
+	go ph.prewarm(path, entries)
+	return nil
+}
+
+func (ph *prewarmHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		n := 1000
+		if limit := r.URL.Query().Get("n"); limit != "" {
+			var err error
+			if n, err = strconv.Atoi(limit); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			} else if n < 0 {
+				http.Error(w, "n must not be negative", http.StatusBadRequest)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		cache.WritePrewarmManifest(w, ph.diskCache.HotEntries(n))
+	case "POST":
+		entries, err := cache.ParsePrewarmManifest(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		go ph.prewarm(r.RemoteAddr, entries)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/anupcshan/bazel-build-worker/remote"
+)
+
+const batchPath = "/batch"
+
+// HandleBatchRequest runs all requests of a RemoteWorkBatchRequest and streams back a RemoteWorkBatchResponse for
+// each as soon as it completes. At most as many requests as there are execution slots are staged at once.
+func (bh *BuildRequestHandler) HandleBatchRequest(w http.ResponseWriter, r *http.Request) {
+	reqFormat := requestFormat(r.Header.Get("Content-Type"))
+	resFormat := responseFormat(r.Header.Get("Accept"), reqFormat)
+
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	batchReq := new(remote.RemoteWorkBatchRequest)
+	if err := reqFormat.unmarshal(b, batchReq); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", resFormat.streamContentType())
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+
+	var wg sync.WaitGroup
+	var writeLock sync.Mutex
+	slots := make(chan struct{}, cap(bh.executionSlots))
+	for i, workReq := range batchReq.GetRequests() {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(index int, workReq *remote.RemoteWorkRequest) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			logger := log.New(os.Stderr, fmt.Sprintf("[%s #%d] ", workReq.OutputKey, index), log.Lshortfile|log.Lmicroseconds)
+			workRes, err := bh.execute(context.Background(), workReq.OutputKey, logger, workReq)
+			batchRes := &remote.RemoteWorkBatchResponse{Index: int32(index), Response: workRes, StatusCode: int32(recordError(workRes, err))}
+
+			writeLock.Lock()
+			defer writeLock.Unlock()
+			if err := resFormat.writeDelimited(w, batchRes); err != nil {
+				logger.Println("Unable to send batch response:", err)
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}(i, workReq)
+	}
+	wg.Wait()
+}
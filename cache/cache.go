@@ -1,5 +1,12 @@
 package cache
 
+import (
+	"errors"
+)
+
+// ErrNotFound is returned by Get when the key is not present in the cache.
+var ErrNotFound = errors.New("cache: key not found")
+
 type Cache interface {
 	Get(string) ([]byte, error)
 	Put(string, []byte) error
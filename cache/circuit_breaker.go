@@ -0,0 +1,137 @@
+package cache
+
+import (
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type CircuitState int
+
+const (
+	CLOSED    CircuitState = iota // Requests flow normally, default
+	OPEN      CircuitState = iota // Backend considered down, requests fail fast
+	HALF_OPEN CircuitState = iota // Cooldown elapsed, a single probe request is let through
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CLOSED:
+		return "closed"
+	case OPEN:
+		return "open"
+	case HALF_OPEN:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// Current state of every circuit breaker, keyed by breaker name.
+var circuitStates = expvar.NewMap("cache_circuit_state")
+
+type circuitOpenError struct {
+	name string
+}
+
+func (e *circuitOpenError) Error() string {
+	return fmt.Sprintf("%s: circuit breaker open", e.name)
+}
+
+// CircuitBreaker stops sending requests to a backend after `threshold` consecutive failures. After `cooldown` it lets
+// one probe request through; success closes the circuit again, failure reopens it for another cooldown.
+type CircuitBreaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	lock     sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+	metric   *expvar.String
+
+	now func() time.Time // Replaced in tests
+}
+
+// NewCircuitBreaker returns a breaker reporting its state under `name`. A threshold of 0 disables the breaker.
+func NewCircuitBreaker(name string, threshold int, cooldown time.Duration) *CircuitBreaker {
+	cb := &CircuitBreaker{
+		name:      name,
+		threshold: threshold,
+		cooldown:  cooldown,
+		metric:    new(expvar.String),
+		now:       time.Now,
+	}
+	circuitStates.Set(name, cb.metric)
+	cb.setState(CLOSED)
+	return cb
+}
+
+// Must be called with lock held.
+func (cb *CircuitBreaker) setState(state CircuitState) {
+	cb.state = state
+	cb.metric.Set(state.String())
+}
+
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	return cb.state
+}
+
+// Allow returns an error if a request should not be sent to the backend right now.
+func (cb *CircuitBreaker) Allow() error {
+	if cb.threshold <= 0 {
+		return nil
+	}
+
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	switch cb.state {
+	case OPEN:
+		if cb.now().Sub(cb.openedAt) < cb.cooldown {
+			return &circuitOpenError{cb.name}
+		}
+		cb.setState(HALF_OPEN)
+		cb.probing = true
+		return nil
+	case HALF_OPEN:
+		if cb.probing {
+			return &circuitOpenError{cb.name}
+		}
+		cb.probing = true
+	}
+
+	return nil
+}
+
+func (cb *CircuitBreaker) Success() {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	cb.failures = 0
+	cb.probing = false
+	if cb.state != CLOSED {
+		cb.setState(CLOSED)
+	}
+}
+
+func (cb *CircuitBreaker) Failure() {
+	if cb.threshold <= 0 {
+		return
+	}
+
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	cb.failures++
+	cb.probing = false
+	if cb.state == HALF_OPEN || cb.failures >= cb.threshold {
+		cb.openedAt = cb.now()
+		cb.setState(OPEN)
+	}
+}
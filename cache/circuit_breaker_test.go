@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a time source for tests that only moves when advanced.
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestBreaker(threshold int, cooldown time.Duration) (*CircuitBreaker, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	cb := NewCircuitBreaker("test", threshold, cooldown)
+	cb.now = clock.now
+	return cb, clock
+}
+
+func TestCircuitBreakerOpensAfterThreshold(t *testing.T) {
+	cb, _ := newTestBreaker(3, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		cb.Failure()
+		if err := cb.Allow(); err != nil {
+			t.Fatalf("Allow() after %d failures = %v", i+1, err)
+		}
+	}
+
+	// A success resets the count of consecutive failures.
+	cb.Success()
+	cb.Failure()
+	cb.Failure()
+	if state := cb.State(); state != CLOSED {
+		t.Fatalf("state after 2 consecutive failures = %s, want closed", state)
+	}
+
+	cb.Failure()
+	if state := cb.State(); state != OPEN {
+		t.Fatalf("state after 3 consecutive failures = %s, want open", state)
+	}
+	if err := cb.Allow(); err == nil {
+		t.Error("Allow() on an open breaker succeeded")
+	}
+}
+
+func TestCircuitBreakerSingleProbe(t *testing.T) {
+	for _, probeSucceeds := range []bool{true, false} {
+		cb, clock := newTestBreaker(1, time.Minute)
+		cb.Failure()
+
+		clock.advance(time.Minute - time.Second)
+		if err := cb.Allow(); err == nil {
+			t.Fatalf("probe succeeds: %v: Allow() before the cooldown elapsed succeeded", probeSucceeds)
+		}
+
+		clock.advance(time.Second)
+		if err := cb.Allow(); err != nil {
+			t.Fatalf("probe succeeds: %v: Allow() for the probe = %v", probeSucceeds, err)
+		}
+		if state := cb.State(); state != HALF_OPEN {
+			t.Fatalf("probe succeeds: %v: state while probing = %s, want half-open", probeSucceeds, state)
+		}
+		if err := cb.Allow(); err == nil {
+			t.Fatalf("probe succeeds: %v: second request while probing was allowed", probeSucceeds)
+		}
+
+		if probeSucceeds {
+			cb.Success()
+			if state := cb.State(); state != CLOSED {
+				t.Errorf("state after a successful probe = %s, want closed", state)
+			}
+			if err := cb.Allow(); err != nil {
+				t.Errorf("Allow() after a successful probe = %v", err)
+			}
+			continue
+		}
+
+		cb.Failure()
+		if state := cb.State(); state != OPEN {
+			t.Errorf("state after a failed probe = %s, want open", state)
+		}
+		if err := cb.Allow(); err == nil {
+			t.Error("Allow() right after a failed probe succeeded, want another cooldown")
+		}
+		clock.advance(time.Minute)
+		if err := cb.Allow(); err != nil {
+			t.Errorf("Allow() for the next probe = %v", err)
+		}
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	cb, _ := newTestBreaker(0, time.Minute)
+	for i := 0; i < 100; i++ {
+		cb.Failure()
+	}
+	if err := cb.Allow(); err != nil {
+		t.Errorf("Allow() on a disabled breaker = %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"expvar"
+	"io"
+	"io/ioutil"
+)
+
+// Compressed entries start with this header. Uncompressed entries are serialized CacheEntry protos, which can never
+// start with a zero byte (field number 0 is invalid), so entries written before compression was enabled are still
+// recognized and returned as is.
+var gzipMagic = []byte("\x00GZ")
+
+var (
+	compressionRawBytes    = expvar.NewInt("cache_compression_raw_bytes")
+	compressionStoredBytes = expvar.NewInt("cache_compression_stored_bytes")
+	compressedEntries      = expvar.NewInt("cache_compressed_entries")
+	uncompressedEntries    = expvar.NewInt("cache_uncompressed_entries")
+)
+
+func init() {
+	expvar.Publish("cache_compression_ratio", expvar.Func(func() interface{} {
+		stored := compressionStoredBytes.Value()
+		if stored == 0 {
+			return 0
+		}
+		return float64(compressionRawBytes.Value()) / float64(stored)
+	}))
+}
+
+// CompressingCache implements Cache interface by gzip-compressing entries of at least `threshold` bytes before
+// handing them to the backing cache.
+type CompressingCache struct {
+	backingCache Cache
+	threshold    int
+}
+
+func NewCompressingCache(backingCache Cache, threshold int) *CompressingCache {
+	return &CompressingCache{backingCache: backingCache, threshold: threshold}
+}
+
+func (c *CompressingCache) Get(key string) ([]byte, error) {
+	b, err := c.backingCache.Get(key)
+	if err != nil || !bytes.HasPrefix(b, gzipMagic) {
+		return b, err
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(b[len(gzipMagic):]))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return ioutil.ReadAll(zr)
+}
+
+func (c *CompressingCache) Put(key string, b []byte) error {
+	compressionRawBytes.Add(int64(len(b)))
+	if len(b) < c.threshold {
+		uncompressedEntries.Add(1)
+		compressionStoredBytes.Add(int64(len(b)))
+		return c.backingCache.Put(key, b)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(gzipMagic)
+	zw := gzip.NewWriter(&buf)
+	zw.Write(b)
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	compressedEntries.Add(1)
+	compressionStoredBytes.Add(int64(buf.Len()))
+	return c.backingCache.Put(key, buf.Bytes())
+}
+
+type compressedReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *compressedReader) Close() error {
+	var err error
+	for _, c := range r.closers {
+		if cerr := c.Close(); cerr != nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (c *CompressingCache) Open(key string) (io.ReadCloser, error) {
+	rc, err := OpenStream(c.backingCache, key)
+	if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(rc)
+	if header, _ := br.Peek(len(gzipMagic)); !bytes.Equal(header, gzipMagic) {
+		return &compressedReader{Reader: br, closers: []io.Closer{rc}}, nil
+	}
+
+	br.Discard(len(gzipMagic))
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return &compressedReader{Reader: zr, closers: []io.Closer{zr, rc}}, nil
+}
+
+// Create holds back the first `threshold` bytes of the entry. Smaller entries are written uncompressed on Close; as
+// soon as the threshold is crossed the entry is streamed through gzip instead.
+func (c *CompressingCache) Create(key string) (BlobWriter, error) {
+	return &compressingBlobWriter{cache: c, key: key}, nil
+}
+
+type countingWriter struct {
+	io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+type compressingBlobWriter struct {
+	cache   *CompressingCache
+	key     string
+	pending bytes.Buffer
+	raw     int64
+
+	backing BlobWriter
+	stored  *countingWriter
+	zw      *gzip.Writer
+}
+
+func (w *compressingBlobWriter) Write(p []byte) (int, error) {
+	w.raw += int64(len(p))
+	if w.zw != nil {
+		return w.zw.Write(p)
+	}
+
+	w.pending.Write(p)
+	if w.pending.Len() < w.cache.threshold {
+		return len(p), nil
+	}
+
+	backing, err := CreateStream(w.cache.backingCache, w.key)
+	if err != nil {
+		return 0, err
+	}
+	w.backing = backing
+	w.stored = &countingWriter{Writer: backing}
+	if _, err := w.stored.Write(gzipMagic); err != nil {
+		return 0, err
+	}
+	w.zw = gzip.NewWriter(w.stored)
+	if _, err := w.pending.WriteTo(w.zw); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *compressingBlobWriter) Close() error {
+	compressionRawBytes.Add(w.raw)
+	if w.zw == nil {
+		uncompressedEntries.Add(1)
+		compressionStoredBytes.Add(int64(w.pending.Len()))
+		return w.cache.backingCache.Put(w.key, w.pending.Bytes())
+	}
+
+	if err := w.zw.Close(); err != nil {
+		w.backing.Abort()
+		return err
+	}
+	compressedEntries.Add(1)
+	compressionStoredBytes.Add(w.stored.n)
+	return w.backing.Close()
+}
+
+func (w *compressingBlobWriter) Abort() error {
+	if w.backing != nil {
+		return w.backing.Abort()
+	}
+	return nil
+}
+
+var _ Cache = new(CompressingCache)
+var _ StreamingCache = new(CompressingCache)
@@ -1,13 +1,18 @@
 package cache
 
 import (
+	"encoding/hex"
+	"expvar"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
-
-	"github.com/anupcshan/bazel-build-worker/remote"
-	"github.com/golang/protobuf/proto"
 )
 
 type Status int
@@ -16,8 +21,6 @@ const (
 	MISSING  Status = iota // Not present in cache, default
 	FETCHING Status = iota // Cache entry being fetched, not ready for use
 	PRESENT  Status = iota // Present in cache
-
-	// TODO(anupc): Cache cleanup
 )
 
 type DiskCache struct {
@@ -25,15 +28,81 @@ type DiskCache struct {
 	cacheDir       string
 	lock           sync.RWMutex
 	state          map[string]Status
-	ongoingFetches map[string]*sync.WaitGroup
+	ongoingFetches map[string]*fetchTask
+	peers          *PeerSet
+
+	// Time until which a PRESENT entry must not be evicted, as requested through EnsureCached.
+	keepUntil map[string]time.Time
+	// Number of Pin calls per local key not yet matched by Unpin. Pinned entries are never evicted.
+	pins map[string]int
+	// Number of EnsureCached calls per local key, to find entries worth prewarming.
+	useCounts map[string]int
+
+	// Keys the backing cache recently did not have, and until when to keep believing that.
+	negativeTTL   time.Duration
+	notFoundUntil map[string]time.Time
 }
 
+var negativeCacheHits = expvar.NewInt("disk_cache_negative_hits")
+
 func NewDiskCache(cacheDir string, backingCache Cache) *DiskCache {
 	return &DiskCache{
 		cacheDir:       cacheDir,
 		backingCache:   backingCache,
 		state:          make(map[string]Status),
-		ongoingFetches: make(map[string]*sync.WaitGroup),
+		ongoingFetches: make(map[string]*fetchTask),
+		notFoundUntil:  make(map[string]time.Time),
+		keepUntil:      make(map[string]time.Time),
+		pins:           make(map[string]int),
+		useCounts:      make(map[string]int),
+	}
+}
+
+// SetPeers makes the cache try to fetch missing keys from other workers before going to the backing cache.
+func (dc *DiskCache) SetPeers(peers *PeerSet) {
+	dc.peers = peers
+}
+
+// SetNegativeTTL makes the cache remember for ttl that the backing cache did not have a key, failing fetches of it
+// with ErrNotFound instead of asking again. A ttl of 0 disables negative caching.
+func (dc *DiskCache) SetNegativeTTL(ttl time.Duration) {
+	dc.negativeTTL = ttl
+}
+
+func (dc *DiskCache) knownMissing(key string) bool {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	until, ok := dc.notFoundUntil[key]
+	if ok && time.Now().After(until) {
+		delete(dc.notFoundUntil, key)
+		return false
+	}
+	if ok {
+		negativeCacheHits.Add(1)
+	}
+	return ok
+}
+
+func (dc *DiskCache) recordMissing(key string) {
+	if dc.negativeTTL <= 0 {
+		return
+	}
+
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	dc.notFoundUntil[key] = time.Now().Add(dc.negativeTTL)
+}
+
+// ForgetMissing drops keys from the negative cache, e.g. because the worker just uploaded them to the backing cache,
+// or because a client was told to upload them and will retry.
+func (dc *DiskCache) ForgetMissing(keys ...string) {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	for _, key := range keys {
+		delete(dc.notFoundUntil, key)
 	}
 }
 
@@ -49,77 +118,191 @@ func (dc *DiskCache) getState(key string) Status {
 	return status
 }
 
-var nilWg sync.WaitGroup
+// fetchTask lets concurrent fetches of a key wait for the one that claimed it, and learn why it failed.
+type fetchTask struct {
+	wg  sync.WaitGroup
+	err error // Only valid once wg is done
+}
 
-func (dc *DiskCache) claimFetchTask(key string) (bool, sync.WaitGroup) {
+func (dc *DiskCache) claimFetchTask(key string) (bool, *fetchTask) {
 	dc.lock.Lock()
 	defer dc.lock.Unlock()
 
 	status, ok := dc.state[key]
 	if ok && status != MISSING {
-		return false, nilWg
+		return false, dc.ongoingFetches[key]
 	}
 
 	dc.state[key] = FETCHING
-	var wg sync.WaitGroup
-	wg.Add(1)
-	dc.ongoingFetches[key] = &wg
-	return true, wg
+	task := new(fetchTask)
+	task.wg.Add(1)
+	dc.ongoingFetches[key] = task
+	return true, task
 }
 
-func (dc *DiskCache) waitForTask(key string) {
-	dc.lock.RLock()
-	wg := dc.ongoingFetches[key]
-	dc.lock.RUnlock()
+func (dc *DiskCache) releaseFetchTask(key string, status Status, err error) {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
 
-	wg.Wait()
+	dc.state[key] = status
+	task := dc.ongoingFetches[key]
+	task.err = err
+	task.wg.Done()
+	delete(dc.ongoingFetches, key)
 }
 
-func (dc *DiskCache) releaseFetchTask(key string, status Status) {
+func (dc *DiskCache) setState(key string, status Status) {
 	dc.lock.Lock()
 	defer dc.lock.Unlock()
 
 	dc.state[key] = status
-	dc.ongoingFetches[key].Done()
 }
 
-func (dc *DiskCache) fetchKey(key string, executable bool) error {
-	if claimed, wg := dc.claimFetchTask(key); !claimed {
-		wg.Wait()
-		// TODO(anupc): Check for fetch status
+// Cached files are symlinked into workdirs, so their permission bits are what actions see. Executable and
+// non-executable copies of the same content are therefore cached separately, the former under key+executableSuffix.
+const executableSuffix = ".x"
+
+func localKey(key string, executable bool) string {
+	if executable {
+		return key + executableSuffix
+	}
+	return key
+}
+
+// Pin protects the entry for key from eviction until a matching call to Unpin, however long that takes. Entries
+// linked into a workdir must stay pinned until the workdir is removed, or the links would dangle. The entry does not
+// have to be cached yet.
+func (dc *DiskCache) Pin(key string, executable bool) {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	dc.pins[localKey(key, executable)]++
+}
+
+func (dc *DiskCache) Unpin(key string, executable bool) {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	lk := localKey(key, executable)
+	if dc.pins[lk]--; dc.pins[lk] <= 0 {
+		delete(dc.pins, lk)
+	}
+}
+
+// retain protects a PRESENT entry from eviction for at least timeout. It returns false if the entry is not present.
+func (dc *DiskCache) retain(localKey string, timeout time.Duration) bool {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	if dc.state[localKey] != PRESENT {
+		return false
+	}
+	if until := time.Now().Add(timeout); until.After(dc.keepUntil[localKey]) {
+		dc.keepUntil[localKey] = until
+	}
+	return true
+}
+
+func (dc *DiskCache) fetchKey(key string, executable bool, timeout time.Duration) error {
+	if dc.knownMissing(key) {
+		return ErrNotFound
+	}
+
+	lk := localKey(key, executable)
+	if claimed, task := dc.claimFetchTask(lk); !claimed {
+		if task != nil {
+			task.wg.Wait()
+			if task.err != nil {
+				return task.err
+			}
+		}
+		if !dc.retain(lk, timeout) {
+			return fmt.Errorf("fetching %s failed", lk)
+		}
 		return nil
 	}
 
-	b, err := dc.backingCache.Get(key)
+	if err := dc.download(key, executable); err != nil {
+		if err == ErrNotFound {
+			dc.recordMissing(key)
+		}
+		dc.releaseFetchTask(lk, MISSING, err)
+		return err
+	}
+
+	// Eviction only considers PRESENT entries, so this is safe to set before releasing.
+	dc.lock.Lock()
+	dc.keepUntil[lk] = time.Now().Add(timeout)
+	dc.lock.Unlock()
+
+	dc.releaseFetchTask(lk, PRESENT, nil)
+	return nil
+}
+
+// download copies the content of key into the cache directory. If the copy with the other permissions is already
+// cached it is copied locally, otherwise a peer that already has the key is preferred over the backing cache.
+func (dc *DiskCache) download(key string, executable bool) error {
+	if other := localKey(key, !executable); dc.getState(other) == PRESENT {
+		if f, err := os.Open(dc.path(other)); err == nil {
+			err = dc.writeBlob(key, executable, f, nil)
+			f.Close()
+			if err == nil {
+				return nil
+			}
+		}
+	}
+
+	// Peers are not trusted to serve what they claim, so their content is only used if it hashes to its key.
+	if h := newHashForKey(key); dc.peers != nil && h != nil {
+		if rc, err := dc.peers.Open(key); err == nil {
+			err = dc.writeBlob(key, executable, rc, h)
+			rc.Close()
+			if err == nil {
+				return nil
+			}
+			peerErrors.Add(1)
+		}
+	}
+
+	rc, err := OpenStream(dc.backingCache, key)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	content, err := NewEntryReader(rc)
 	if err != nil {
-		dc.releaseFetchTask(key, MISSING)
 		return err
 	}
 
-	filePath := filepath.Join(dc.cacheDir, key)
+	return dc.writeBlob(key, executable, content, nil)
+}
+
+// writeBlob stores content as the entry for key. If verify is not nil, content is hashed with it and the entry is
+// only stored if the digest matches key.
+func (dc *DiskCache) writeBlob(key string, executable bool, content io.Reader, verify hash.Hash) error {
 	perm := os.FileMode(0644)
 	if executable {
 		perm = 0755
 	}
-	if f, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY, perm); err != nil {
-		dc.releaseFetchTask(key, MISSING)
-		return err
-	} else {
-		defer f.Close()
-		cacheEntry := new(remote.CacheEntry)
-
-		err = proto.Unmarshal(b, cacheEntry)
-		if err != nil {
-			dc.releaseFetchTask(key, MISSING)
-			return err
-		}
-		_, err = f.Write(cacheEntry.FileContent)
-		dc.releaseFetchTask(key, MISSING)
+	w, err := dc.newBlobWriter(localKey(key, executable), perm)
+	if err != nil {
 		return err
 	}
 
-	dc.releaseFetchTask(key, PRESENT)
-	return nil
+	dst := io.Writer(w)
+	if verify != nil {
+		dst = io.MultiWriter(w, verify)
+	}
+	if _, err := io.Copy(dst, content); err != nil {
+		w.Abort()
+		return err
+	}
+	if verify != nil && hex.EncodeToString(verify.Sum(nil)) != key {
+		w.Abort()
+		return fmt.Errorf("content of %s does not match its key", key)
+	}
+	return w.commit()
 }
 
 // Ensure a key is cached on disk for a given duration, returns the a "future" to the result
@@ -127,29 +310,145 @@ func (dc *DiskCache) EnsureCached(key string, executable bool, timeout time.Dura
 	errChan := make(chan error)
 
 	go func(errCh chan<- error) {
-		state := dc.getState(key)
+		lk := localKey(key, executable)
+		dc.recordUse(lk)
+		state := dc.getState(lk)
 		switch state {
 		case PRESENT:
 			// TODO(anupc): Should we stat the file to verify?
-			errCh <- nil
+			if dc.retain(lk, timeout) {
+				errCh <- nil
+				return
+			}
+			// Evicted in the meantime.
+			errCh <- dc.fetchKey(key, executable, timeout)
 			return
 		case MISSING:
-			errCh <- dc.fetchKey(key, executable)
+			errCh <- dc.fetchKey(key, executable, timeout)
 			return
 		case FETCHING:
-			// TODO(anupc): Return reference to the future where fetch is happening
-			dc.waitForTask(key)
-			errCh <- nil
+			// fetchKey waits for the ongoing fetch and reports whether it succeeded.
+			errCh <- dc.fetchKey(key, executable, timeout)
 			return
 		}
-		// cachePath := filepath.Join(dc.cacheDir, key)
 		errCh <- nil
 	}(errChan)
 
 	return errChan
 }
 
-func (dc *DiskCache) GetLink(key string) string {
+// IsCached reports whether the content of key is already present on local disk, with either permissions.
+func (dc *DiskCache) IsCached(key string) bool {
+	return dc.getState(localKey(key, false)) == PRESENT || dc.getState(localKey(key, true)) == PRESENT
+}
+
+// Open returns the locally cached content of key, or ErrNotFound if it is not on disk.
+func (dc *DiskCache) Open(key string) (io.ReadCloser, error) {
+	for _, executable := range []bool{false, true} {
+		if dc.getState(localKey(key, executable)) == PRESENT {
+			return os.Open(dc.GetLink(key, executable))
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// Create adds an entry to the cache directory directly. The entry only becomes visible once the writer is closed.
+func (dc *DiskCache) Create(key string) (BlobWriter, error) {
+	w, err := dc.newBlobWriter(key, 0644)
+	if err != nil {
+		return nil, err
+	}
+	w.markPresent = true
+	return w, nil
+}
+
+func (dc *DiskCache) newBlobWriter(key string, perm os.FileMode) (*diskBlobWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(dc.path(key)), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dc.tmpDir(), 0755); err != nil {
+		return nil, err
+	}
+
+	f, err := ioutil.TempFile(dc.tmpDir(), "blob")
+	if err != nil {
+		return nil, err
+	}
+
+	return &diskBlobWriter{File: f, dc: dc, key: key, perm: perm}, nil
+}
+
+// diskBlobWriter writes to a temporary file that is renamed into place on commit, so a partially written entry is
+// never visible under its key.
+type diskBlobWriter struct {
+	*os.File
+	dc          *DiskCache
+	key         string // Local key, including executableSuffix if applicable
+	perm        os.FileMode
+	markPresent bool
+}
+
+func (w *diskBlobWriter) commit() error {
+	if err := w.File.Close(); err != nil {
+		os.Remove(w.Name())
+		return err
+	}
+	if err := os.Chmod(w.Name(), w.perm); err != nil {
+		os.Remove(w.Name())
+		return err
+	}
+	if err := os.Rename(w.Name(), w.dc.path(w.key)); err != nil {
+		os.Remove(w.Name())
+		return err
+	}
+	return nil
+}
+
+func (w *diskBlobWriter) Close() error {
+	if err := w.commit(); err != nil {
+		return err
+	}
+
+	if w.markPresent {
+		w.dc.setState(w.key, PRESENT)
+		w.dc.ForgetMissing(strings.TrimSuffix(w.key, executableSuffix))
+	}
+	return nil
+}
+
+func (w *diskBlobWriter) Abort() error {
+	w.File.Close()
+	return os.Remove(w.Name())
+}
+
+// ServeHTTP serves the content of locally cached keys under PeerPathPrefix, for other workers' PeerSets. It never
+// fetches keys that are not already on disk.
+func (dc *DiskCache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, PeerPathPrefix)
+	if key == "" || strings.Contains(key, "/") {
+		http.Error(w, "invalid key", http.StatusBadRequest)
+		return
+	}
+
+	f, err := dc.Open(key)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	if r.Method == "HEAD" {
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	io.Copy(w, f)
+}
+
+// GetLink returns the path of the cached copy of key with the given permissions.
+func (dc *DiskCache) GetLink(key string, executable bool) string {
 	// TODO(anupc): Assert key in cache?
-	return filepath.Join(dc.cacheDir, key)
+	return dc.path(localKey(key, executable))
 }
+
+var _ StreamingCache = new(DiskCache)
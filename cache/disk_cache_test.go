@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memCache is a Cache holding its entries in memory.
+type memCache struct {
+	lock    sync.Mutex
+	entries map[string][]byte
+	gets    int
+}
+
+func newMemCache() *memCache {
+	return &memCache{entries: make(map[string][]byte)}
+}
+
+func (c *memCache) Get(key string) ([]byte, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.gets++
+	b, ok := c.entries[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return b, nil
+}
+
+func (c *memCache) Put(key string, b []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.entries[key] = b
+	return nil
+}
+
+// putContent stores content in c the way clients upload files, and returns its key.
+func putContent(t *testing.T, c Cache, content string) string {
+	sum := md5.Sum([]byte(content))
+	key := hex.EncodeToString(sum[:])
+
+	// A serialized CacheEntry with just file_content.
+	entry := append([]byte{fileContentField<<3 | wireLengthDelimited, byte(len(content))}, content...)
+	if err := c.Put(key, entry); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newTestDiskCache(t *testing.T, backingCache Cache) (*DiskCache, func()) {
+	cacheDir, err := ioutil.TempDir("", "disk_cache_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dc := NewDiskCache(cacheDir, backingCache)
+	if err := dc.Load(); err != nil {
+		os.RemoveAll(cacheDir)
+		t.Fatal(err)
+	}
+	return dc, func() { os.RemoveAll(cacheDir) }
+}
+
+func TestEnsureCachedBothPermissions(t *testing.T) {
+	for _, firstExecutable := range []bool{false, true} {
+		backingCache := newMemCache()
+		key := putContent(t, backingCache, "#!/bin/sh\necho hello\n")
+		dc, cleanup := newTestDiskCache(t, backingCache)
+
+		for _, executable := range []bool{firstExecutable, !firstExecutable} {
+			if err := <-dc.EnsureCached(key, executable, time.Minute); err != nil {
+				t.Fatalf("EnsureCached(%s, %v) = %v", key, executable, err)
+			}
+		}
+
+		for _, executable := range []bool{false, true} {
+			want := os.FileMode(0644)
+			if executable {
+				want = 0755
+			}
+
+			fi, err := os.Stat(dc.GetLink(key, executable))
+			if err != nil {
+				t.Errorf("executable first: %v: %v", firstExecutable, err)
+			} else if mode := fi.Mode(); mode != want {
+				t.Errorf("executable first: %v: GetLink(%s, %v) has mode %s, want %s", firstExecutable, key, executable, mode, want)
+			}
+		}
+
+		if backingCache.gets != 1 {
+			t.Errorf("executable first: %v: %d fetches from the backing cache, want the second copy made locally", firstExecutable, backingCache.gets)
+		}
+		cleanup()
+	}
+}
+
+func TestEnsureCachedRejectsCorruptPeerContent(t *testing.T) {
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not what was asked for"))
+	}))
+	defer peer.Close()
+
+	backingCache := newMemCache()
+	key := putContent(t, backingCache, "hello\n")
+	dc, cleanup := newTestDiskCache(t, backingCache)
+	defer cleanup()
+	dc.SetPeers(NewPeerSet([]string{peer.URL}, time.Second))
+
+	if err := <-dc.EnsureCached(key, false, time.Minute); err != nil {
+		t.Fatalf("EnsureCached(%s) = %v", key, err)
+	}
+
+	if b, err := ioutil.ReadFile(dc.GetLink(key, false)); err != nil || string(b) != "hello\n" {
+		t.Errorf("cached content is %q, %v, want the content from the backing cache", b, err)
+	}
+	if backingCache.gets != 1 {
+		t.Errorf("%d fetches from the backing cache, want 1", backingCache.gets)
+	}
+}
+
+func TestEvictSkipsPinnedEntries(t *testing.T) {
+	backingCache := newMemCache()
+	key := putContent(t, backingCache, "hello\n")
+	dc, cleanup := newTestDiskCache(t, backingCache)
+	defer cleanup()
+
+	// Pinned twice, as if by two requests using the same input.
+	dc.Pin(key, false)
+	dc.Pin(key, false)
+	if err := <-dc.EnsureCached(key, false, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	for pins := 2; pins >= 0; pins-- {
+		freed, err := dc.Evict(1 << 30)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cached := dc.IsCached(key); cached != (pins > 0) {
+			t.Errorf("with %d pins: cached after Evict = %v, freed %d bytes", pins, cached, freed)
+		}
+		if pins > 0 {
+			dc.Unpin(key, false)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"expvar"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+)
+
+var (
+	evictedEntries = expvar.NewInt("disk_cache_evicted_entries")
+	evictedBytes   = expvar.NewInt("disk_cache_evicted_bytes")
+)
+
+type evictionCandidate struct {
+	localKey  string
+	keepUntil time.Time
+}
+
+type byKeepUntil []evictionCandidate
+
+func (c byKeepUntil) Len() int           { return len(c) }
+func (c byKeepUntil) Less(i, j int) bool { return c[i].keepUntil.Before(c[j].keepUntil) }
+func (c byKeepUntil) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+
+// Evict removes entries until at least `bytes` bytes have been freed or nothing else can be removed, and returns the
+// number of bytes freed. Entries whose retention (see EnsureCached) expired longest ago go first; entries that are
+// still retained or pinned (see Pin) are never evicted.
+func (dc *DiskCache) Evict(bytes int64) (int64, error) {
+	now := time.Now()
+
+	dc.lock.RLock()
+	var candidates []evictionCandidate
+	for lk, status := range dc.state {
+		if status == PRESENT && !dc.keepUntil[lk].After(now) && dc.pins[lk] == 0 {
+			candidates = append(candidates, evictionCandidate{localKey: lk, keepUntil: dc.keepUntil[lk]})
+		}
+	}
+	dc.lock.RUnlock()
+
+	sort.Sort(byKeepUntil(candidates))
+
+	var freed int64
+	for _, candidate := range candidates {
+		if freed >= bytes {
+			break
+		}
+
+		evicted, err := dc.evictEntry(candidate.localKey, now)
+		if err != nil {
+			return freed, err
+		}
+		if evicted == "" {
+			continue
+		}
+
+		if info, err := os.Stat(evicted); err == nil {
+			freed += info.Size()
+			evictedBytes.Add(info.Size())
+		}
+		evictedEntries.Add(1)
+		if err := os.Remove(evicted); err != nil {
+			return freed, err
+		}
+	}
+
+	return freed, nil
+}
+
+// evictEntry marks an entry MISSING and moves its file out of the way, returning the file's new path. It does
+// nothing and returns "" if the entry was retained, pinned or changed state since it was picked.
+func (dc *DiskCache) evictEntry(localKey string, now time.Time) (string, error) {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	if dc.state[localKey] != PRESENT || dc.keepUntil[localKey].After(now) || dc.pins[localKey] > 0 {
+		return "", nil
+	}
+
+	// Moving the file while holding the lock ensures a fetch of the same key that starts right after cannot have its
+	// freshly written file deleted by us.
+	f, err := ioutil.TempFile(dc.tmpDir(), "evict")
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	if err := os.Rename(dc.path(localKey), f.Name()); os.IsNotExist(err) {
+		os.Remove(f.Name())
+		dc.state[localKey] = MISSING
+		return "", nil
+	} else if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	dc.state[localKey] = MISSING
+	delete(dc.keepUntil, localKey)
+	return f.Name(), nil
+}
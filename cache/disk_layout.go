@@ -0,0 +1,236 @@
+package cache
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Entries are stored as <cachedir>/<first two characters of key>/<key>, the same layout git and Bazel's disk cache
+// use, to keep directories small enough for the file system and for tools like ls. Files being written live in
+// <cachedir>/tmp until they are complete, and entries found to be corrupt are moved to <cachedir>/quarantine.
+
+const tmpDirName = "tmp"
+
+func prefixDir(localKey string) string {
+	if len(localKey) < 2 {
+		return localKey
+	}
+	return localKey[:2]
+}
+
+func (dc *DiskCache) path(localKey string) string {
+	return filepath.Join(dc.cacheDir, prefixDir(localKey), localKey)
+}
+
+func (dc *DiskCache) tmpDir() string {
+	return filepath.Join(dc.cacheDir, tmpDirName)
+}
+
+func isPrefixDir(name string) bool {
+	if len(name) != 2 {
+		return false
+	}
+	for _, c := range name {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// isEntryName reports whether name is that of a cache entry: a hex content key, optionally followed by
+// executableSuffix.
+func isEntryName(name string) bool {
+	key := strings.TrimSuffix(name, executableSuffix)
+	return key != "" && strings.Trim(key, "0123456789abcdef") == ""
+}
+
+// IsContentKey reports whether key is a hex digest of a hash function entries can be verified with. Keys from
+// clients must be checked with it before they are used to name files.
+func IsContentKey(key string) bool {
+	return strings.Trim(key, "0123456789abcdef") == "" && newHashForKey(key) != nil
+}
+
+// Load indexes the entries already present in the cache directory so they are not fetched again. Entries left in
+// the flat layout used by older versions are moved into their prefix directories first, and leftovers of
+// interrupted writes are removed. Files not named after a content key of a known digest are left alone.
+func (dc *DiskCache) Load() error {
+	if err := os.RemoveAll(dc.tmpDir()); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dc.tmpDir(), 0755); err != nil {
+		return err
+	}
+
+	entries, err := ioutil.ReadDir(dc.cacheDir)
+	if err != nil {
+		return err
+	}
+
+	migrated, discarded := 0, 0
+	for _, entry := range entries {
+		switch {
+		case entry.IsDir() || entry.Name() == useCountsFileName:
+			continue
+		case strings.HasPrefix(entry.Name(), ".tmp-"):
+			if err := os.Remove(filepath.Join(dc.cacheDir, entry.Name())); err != nil {
+				return err
+			}
+		case entry.Mode().IsRegular() && IsContentKey(strings.TrimSuffix(entry.Name(), executableSuffix)):
+			ok, err := dc.migrateEntry(entry.Name())
+			if err != nil {
+				return err
+			}
+			if ok {
+				migrated++
+			} else {
+				discarded++
+			}
+		default:
+			log.Printf("Ignoring %s in cache directory", entry.Name())
+		}
+	}
+	if migrated > 0 || discarded > 0 {
+		log.Printf("Migrated %d entries in %s to the sharded layout, discarded %d that did not match their key", migrated, dc.cacheDir, discarded)
+	}
+
+	if err := dc.loadUseCounts(); err != nil {
+		log.Printf("Unable to load use counts: %s", err)
+	}
+
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	return dc.walkEntries(func(localKey string, info os.FileInfo) {
+		dc.state[localKey] = PRESENT
+	})
+}
+
+// migrateEntry moves an entry from the flat layout into its prefix directory. Older versions wrote entries in place,
+// so they may be incomplete: entries whose content does not hash to their key are removed instead, and false is
+// returned.
+func (dc *DiskCache) migrateEntry(localKey string) (bool, error) {
+	src := filepath.Join(dc.cacheDir, localKey)
+	if !matchesKey(src, strings.TrimSuffix(localKey, executableSuffix)) {
+		return false, os.Remove(src)
+	}
+
+	dest := dc.path(localKey)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return false, err
+	}
+	if err := os.Rename(src, dest); err != nil {
+		return false, err
+	}
+	// Older versions created files with whichever permissions the first action asked for.
+	perm := os.FileMode(0644)
+	if strings.HasSuffix(localKey, executableSuffix) {
+		perm = 0755
+	}
+	return true, os.Chmod(dest, perm)
+}
+
+// matchesKey reports whether the content of the file at path hashes to key. Keys of unknown digests never match.
+func matchesKey(path string, key string) bool {
+	h := newHashForKey(key)
+	if h == nil {
+		return false
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return false
+	}
+	return hex.EncodeToString(h.Sum(nil)) == key
+}
+
+// walkEntries calls fn for every file in a prefix directory.
+func (dc *DiskCache) walkEntries(fn func(localKey string, info os.FileInfo)) error {
+	dirs, err := ioutil.ReadDir(dc.cacheDir)
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range dirs {
+		if !dir.IsDir() || !isPrefixDir(dir.Name()) {
+			continue
+		}
+
+		files, err := ioutil.ReadDir(filepath.Join(dc.cacheDir, dir.Name()))
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if file.Mode().IsRegular() {
+				fn(file.Name(), file)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Fsck checks that the cache directory follows the sharded layout and returns a description of every problem found.
+// It does not modify anything.
+func (dc *DiskCache) Fsck() ([]string, error) {
+	var problems []string
+
+	entries, err := ioutil.ReadDir(dc.cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		name := filepath.Join(dc.cacheDir, entry.Name())
+		switch {
+		case entry.IsDir() && (entry.Name() == tmpDirName || entry.Name() == quarantineDirName):
+		case !entry.IsDir() && entry.Name() == useCountsFileName:
+		case entry.IsDir() && isPrefixDir(entry.Name()):
+			files, err := ioutil.ReadDir(name)
+			if err != nil {
+				return nil, err
+			}
+			for _, file := range files {
+				problems = append(problems, fsckEntry(entry.Name(), filepath.Join(name, file.Name()), file)...)
+			}
+		case entry.IsDir():
+			problems = append(problems, fmt.Sprintf("%s: unexpected directory", name))
+		default:
+			problems = append(problems, fmt.Sprintf("%s: file outside a prefix directory (not migrated?)", name))
+		}
+	}
+
+	return problems, nil
+}
+
+func fsckEntry(prefix string, path string, info os.FileInfo) []string {
+	if !info.Mode().IsRegular() {
+		return []string{fmt.Sprintf("%s: not a regular file", path)}
+	}
+
+	var problems []string
+	if prefixDir(info.Name()) != prefix {
+		problems = append(problems, fmt.Sprintf("%s: belongs in %s/", path, prefixDir(info.Name())))
+	}
+
+	executable := strings.HasSuffix(info.Name(), executableSuffix)
+	if !isEntryName(info.Name()) {
+		problems = append(problems, fmt.Sprintf("%s: not a hex content key", path))
+	}
+	if isExecutable := info.Mode().Perm()&0111 != 0; isExecutable != executable {
+		problems = append(problems, fmt.Sprintf("%s: unexpected permissions %s", path, info.Mode().Perm()))
+	}
+
+	return problems
+}
@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadMigratesOnlyVerifiedEntries(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "disk_layout_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	sum := md5.Sum([]byte("hello\n"))
+	good := hex.EncodeToString(sum[:])
+	partial := hex.EncodeToString(make([]byte, md5.Size))
+	files := map[string]string{
+		good + executableSuffix: "hello\n",
+		partial:                 "hel",
+		"a":                     "not an entry",
+		"README":                "not an entry either",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(cacheDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dc := NewDiskCache(cacheDir, newMemCache())
+	if err := dc.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if fi, err := os.Stat(dc.GetLink(good, true)); err != nil {
+		t.Error(err)
+	} else if fi.Mode() != 0755 {
+		t.Errorf("migrated entry has mode %s, want 0755", fi.Mode())
+	}
+	if !dc.IsCached(good) {
+		t.Errorf("migrated entry %s is not cached", good)
+	}
+
+	if dc.IsCached(partial) {
+		t.Errorf("entry %s not matching its key is cached", partial)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, partial)); !os.IsNotExist(err) {
+		t.Errorf("entry %s not matching its key was not removed: %v", partial, err)
+	}
+
+	for _, name := range []string{"a", "README"} {
+		if b, err := ioutil.ReadFile(filepath.Join(cacheDir, name)); err != nil || string(b) != files[name] {
+			t.Errorf("%s was not left alone: %q, %v", name, b, err)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Encrypted entries are laid out as encryptedMagic, a one byte key ID length, the key ID, the GCM nonce and finally
+// the sealed entry. Like gzipMagic, the leading zero byte keeps them apart from plain serialized CacheEntry protos.
+var encryptedMagic = []byte("\x00ENC")
+
+var errPlaintextEntry = errors.New("cache: refusing to read unencrypted entry")
+
+// Keyring holds the AES keys entries may be encrypted with. New entries are always encrypted with the active key;
+// older keys stay in the keyring so that entries written before a rotation can still be read.
+type Keyring struct {
+	keys   map[string]cipher.AEAD
+	active string
+}
+
+// LoadKeyring reads a keyring file containing one "<key ID> <hex encoded AES key>" pair per line. Empty lines and
+// lines starting with # are ignored. The last key in the file is the active one, so rotating keys means appending a
+// new line and restarting workers.
+func LoadKeyring(path string) (*Keyring, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	kr := &Keyring{keys: make(map[string]cipher.AEAD)}
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 || len(fields[0]) > 255 {
+			return nil, fmt.Errorf("%s:%d: expected \"<key ID> <hex key>\"", path, lineNo)
+		}
+		key, err := hex.DecodeString(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, lineNo, err)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, lineNo, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, lineNo, err)
+		}
+
+		kr.keys[fields[0]] = aead
+		kr.active = fields[0]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if kr.active == "" {
+		return nil, fmt.Errorf("%s: no keys found", path)
+	}
+	return kr, nil
+}
+
+// EncryptingCache implements Cache interface by sealing entries with AES-GCM before they reach the backing cache.
+// The cache key is used as additional authenticated data, so an entry cannot be passed off as a different key.
+type EncryptingCache struct {
+	backingCache   Cache
+	keyring        *Keyring
+	allowPlaintext bool
+}
+
+// NewEncryptingCache wraps backingCache. If allowPlaintext is set, unencrypted entries written before encryption was
+// enabled are returned as is instead of failing.
+func NewEncryptingCache(backingCache Cache, keyring *Keyring, allowPlaintext bool) *EncryptingCache {
+	return &EncryptingCache{backingCache: backingCache, keyring: keyring, allowPlaintext: allowPlaintext}
+}
+
+func (c *EncryptingCache) Get(key string) ([]byte, error) {
+	b, err := c.backingCache.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(b, encryptedMagic) {
+		if c.allowPlaintext {
+			return b, nil
+		}
+		return nil, errPlaintextEntry
+	}
+
+	b = b[len(encryptedMagic):]
+	if len(b) < 1 || len(b) < 1+int(b[0]) {
+		return nil, fmt.Errorf("cache entry %s: truncated encryption header", key)
+	}
+	keyIDLen := int(b[0])
+	keyID := string(b[1 : 1+keyIDLen])
+	b = b[1+keyIDLen:]
+
+	aead, ok := c.keyring.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("cache entry %s: encrypted with unknown key %q", key, keyID)
+	}
+	if len(b) < aead.NonceSize() {
+		return nil, fmt.Errorf("cache entry %s: truncated encryption header", key)
+	}
+
+	return aead.Open(nil, b[:aead.NonceSize()], b[aead.NonceSize():], []byte(key))
+}
+
+func (c *EncryptingCache) Put(key string, b []byte) error {
+	aead := c.keyring.keys[c.keyring.active]
+
+	header := make([]byte, 0, len(encryptedMagic)+1+len(c.keyring.active)+aead.NonceSize())
+	header = append(header, encryptedMagic...)
+	header = append(header, byte(len(c.keyring.active)))
+	header = append(header, c.keyring.active...)
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	header = append(header, nonce...)
+
+	return c.backingCache.Put(key, aead.Seal(header, nonce, b, []byte(key)))
+}
+
+var _ Cache = new(EncryptingCache)
@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+const (
+	testKeyA = "000102030405060708090a0b0c0d0e0f"
+	testKeyB = "101112131415161718191a1b1c1d1e1f"
+)
+
+func newTestKeyring(t *testing.T, lines string) *Keyring {
+	f, err := ioutil.TempFile("", "keyring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	f.WriteString(lines)
+	f.Close()
+	kr, err := LoadKeyring(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kr
+}
+
+func TestEncryptingCache(t *testing.T) {
+	const keyA, keyB = "aaaa", "bbbb"
+
+	tests := []struct {
+		name string
+		// Prepares the backing cache, whose entry readKey is then read with readKeyring.
+		write          func(t *testing.T, backing *memCache)
+		readKeyring    string
+		allowPlaintext bool
+		readKey        string
+		wantErr        bool
+	}{
+		{
+			name: "active key",
+			write: func(t *testing.T, backing *memCache) {
+				NewEncryptingCache(backing, newTestKeyring(t, "1 "+testKeyA+"\n"), false).Put(keyA, []byte("content"))
+			},
+			readKeyring: "1 " + testKeyA + "\n",
+			readKey:     keyA,
+		},
+		{
+			name: "older key after rotation",
+			write: func(t *testing.T, backing *memCache) {
+				NewEncryptingCache(backing, newTestKeyring(t, "1 "+testKeyA+"\n"), false).Put(keyA, []byte("content"))
+			},
+			readKeyring: "1 " + testKeyA + "\n2 " + testKeyB + "\n",
+			readKey:     keyA,
+		},
+		{
+			name: "unknown key ID",
+			write: func(t *testing.T, backing *memCache) {
+				NewEncryptingCache(backing, newTestKeyring(t, "1 "+testKeyA+"\n"), false).Put(keyA, []byte("content"))
+			},
+			readKeyring: "2 " + testKeyB + "\n",
+			readKey:     keyA,
+			wantErr:     true,
+		},
+		{
+			name: "entry moved to another cache key",
+			write: func(t *testing.T, backing *memCache) {
+				NewEncryptingCache(backing, newTestKeyring(t, "1 "+testKeyA+"\n"), false).Put(keyA, []byte("content"))
+				b, _ := backing.Get(keyA)
+				backing.Put(keyB, b)
+			},
+			readKeyring: "1 " + testKeyA + "\n",
+			readKey:     keyB,
+			wantErr:     true,
+		},
+		{
+			name: "plaintext rejected",
+			write: func(t *testing.T, backing *memCache) {
+				backing.Put(keyA, []byte("content"))
+			},
+			readKeyring: "1 " + testKeyA + "\n",
+			readKey:     keyA,
+			wantErr:     true,
+		},
+		{
+			name: "plaintext allowed",
+			write: func(t *testing.T, backing *memCache) {
+				backing.Put(keyA, []byte("content"))
+			},
+			readKeyring:    "1 " + testKeyA + "\n",
+			allowPlaintext: true,
+			readKey:        keyA,
+		},
+		{
+			name: "truncated key ID",
+			write: func(t *testing.T, backing *memCache) {
+				backing.Put(keyA, append(append([]byte{}, encryptedMagic...), 5, '1'))
+			},
+			readKeyring: "1 " + testKeyA + "\n",
+			readKey:     keyA,
+			wantErr:     true,
+		},
+		{
+			name: "truncated nonce",
+			write: func(t *testing.T, backing *memCache) {
+				backing.Put(keyA, append(append([]byte{}, encryptedMagic...), 1, '1', 0, 0, 0))
+			},
+			readKeyring: "1 " + testKeyA + "\n",
+			readKey:     keyA,
+			wantErr:     true,
+		},
+		{
+			name: "magic only",
+			write: func(t *testing.T, backing *memCache) {
+				backing.Put(keyA, encryptedMagic)
+			},
+			readKeyring: "1 " + testKeyA + "\n",
+			readKey:     keyA,
+			wantErr:     true,
+		},
+	}
+
+	for _, test := range tests {
+		backing := newMemCache()
+		test.write(t, backing)
+
+		c := NewEncryptingCache(backing, newTestKeyring(t, test.readKeyring), test.allowPlaintext)
+		b, err := c.Get(test.readKey)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: Get(%s) = %q, want an error", test.name, test.readKey, b)
+			}
+		} else if err != nil || string(b) != "content" {
+			t.Errorf("%s: Get(%s) = %q, %v, want %q", test.name, test.readKey, b, err, "content")
+		}
+	}
+}
+
+func TestEncryptingCacheUsesActiveKey(t *testing.T) {
+	backing := newMemCache()
+	c := NewEncryptingCache(backing, newTestKeyring(t, "1 "+testKeyA+"\n2 "+testKeyB+"\n"), false)
+	if err := c.Put("aaaa", []byte("content")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the active key can decrypt the new entry.
+	if _, err := NewEncryptingCache(backing, newTestKeyring(t, "2 "+testKeyB+"\n"), false).Get("aaaa"); err != nil {
+		t.Errorf("Get with only the active key = %v", err)
+	}
+	if _, err := NewEncryptingCache(backing, newTestKeyring(t, "1 "+testKeyA+"\n"), false).Get("aaaa"); err == nil {
+		t.Error("Get with only the old key succeeded")
+	}
+}
@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// Blobs are stored as a serialized remote.CacheEntry holding just file_content. These helpers read and write that
+// framing directly so that file contents never need to be held in memory as a whole.
+
+const (
+	wireVarint          = 0
+	wire64Bit           = 1
+	wireLengthDelimited = 2
+	wire32Bit           = 5
+
+	fileContentField = 2
+)
+
+// NewEntryReader returns a reader over the file_content of the serialized CacheEntry in r.
+func NewEntryReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	for {
+		tag, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			// No file_content field, which is how an empty file is encoded.
+			return br, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		var skip uint64
+		switch tag & 7 {
+		case wireVarint:
+			_, err = binary.ReadUvarint(br)
+		case wire64Bit:
+			skip = 8
+		case wire32Bit:
+			skip = 4
+		case wireLengthDelimited:
+			skip, err = binary.ReadUvarint(br)
+			if err == nil && tag>>3 == fileContentField {
+				return io.LimitReader(br, int64(skip)), nil
+			}
+		default:
+			err = fmt.Errorf("unsupported wire type %d in cache entry", tag&7)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := io.CopyN(ioutil.Discard, br, int64(skip)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// PutEntry stores the `size` bytes read from r as a CacheEntry under key.
+func PutEntry(c Cache, key string, r io.Reader, size int64) error {
+	w, err := CreateStream(c, key)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, 1+binary.MaxVarintLen64)
+	header[0] = fileContentField<<3 | wireLengthDelimited
+	n := 1 + binary.PutUvarint(header[1:], uint64(size))
+	if _, err := w.Write(header[:n]); err != nil {
+		w.Abort()
+		return err
+	}
+
+	if written, err := io.Copy(w, r); err != nil {
+		w.Abort()
+		return err
+	} else if written != size {
+		w.Abort()
+		return fmt.Errorf("cache entry %s: expected %d bytes, got %d", key, size, written)
+	}
+
+	return w.Close()
+}
@@ -2,49 +2,261 @@ package cache
 
 import (
 	"bytes"
+	"expvar"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"os"
+	"sync"
+	"time"
 )
 
+var hazelcastRetries = expvar.NewInt("hazelcast_cache_retries")
+
+type HazelcastCacheOptions struct {
+	RetryPolicy RetryPolicy
+
+	// Consecutive failed requests after which the endpoint is considered down. 0 disables circuit breaking.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	// Maximum number of requests in flight to the endpoint at any time. Further requests wait for a free slot.
+	MaxInFlight           int
+	MaxIdleConnsPerHost   int
+	ResponseHeaderTimeout time.Duration
+}
+
+var DefaultHazelcastCacheOptions = HazelcastCacheOptions{
+	RetryPolicy:      DefaultRetryPolicy,
+	BreakerThreshold: 5,
+	BreakerCooldown:  30 * time.Second,
+
+	MaxInFlight:           64,
+	MaxIdleConnsPerHost:   64,
+	ResponseHeaderTimeout: time.Minute,
+}
+
 // HazelcastCache implements Cache interface backed by a Hazelcast/REST-based map
 type HazelcastCache struct {
 	hazelCastAPIBase string
 	httpClient       *http.Client
+	retryPolicy      RetryPolicy
+	breaker          *CircuitBreaker
+	inFlight         chan struct{}
+}
+
+func NewHazelcastCache(hazelCastAPIBase string, opts HazelcastCacheOptions) *HazelcastCache {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		Dial: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).Dial,
+		TLSHandshakeTimeout:   10 * time.Second,
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		ResponseHeaderTimeout: opts.ResponseHeaderTimeout,
+	}
+
+	maxInFlight := opts.MaxInFlight
+	if maxInFlight < 1 {
+		maxInFlight = 1
+	}
+
+	return &HazelcastCache{
+		hazelCastAPIBase: hazelCastAPIBase,
+		httpClient:       &http.Client{Transport: transport},
+		retryPolicy:      opts.RetryPolicy,
+		breaker:          NewCircuitBreaker(hazelCastAPIBase, opts.BreakerThreshold, opts.BreakerCooldown),
+		inFlight:         make(chan struct{}, maxInFlight),
+	}
+}
+
+// withRetries runs op until it succeeds, fails with a non-retryable error or the retry policy is exhausted.
+func (c *HazelcastCache) withRetries(op func() error) error {
+	for attempt := 1; ; attempt++ {
+		if err := c.breaker.Allow(); err != nil {
+			return err
+		}
+
+		err := op()
+		if !isRetryable(err) {
+			c.breaker.Success()
+			return err
+		}
 
-	// TODO(anupc): Limit outstanding requests
+		c.breaker.Failure()
+		if attempt >= c.retryPolicy.MaxAttempts {
+			return err
+		}
+		hazelcastRetries.Add(1)
+		time.Sleep(c.retryPolicy.Backoff(attempt))
+	}
 }
 
-func NewHazelcastCache(hazelCastAPIBase string) *HazelcastCache {
-	return &HazelcastCache{hazelCastAPIBase: hazelCastAPIBase, httpClient: http.DefaultClient}
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
 }
 
-func (c *HazelcastCache) Get(key string) ([]byte, error) {
-	resp, err := c.httpClient.Get(fmt.Sprintf("%s/%s", c.hazelCastAPIBase, key))
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// roundTrip sends req while holding an in-flight slot. The slot is released once the response body is closed.
+func (c *HazelcastCache) roundTrip(req *http.Request) (*http.Response, error) {
+	c.inFlight <- struct{}{}
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		// TODO(anupc): Retries
+		<-c.inFlight
 		return nil, err
 	}
 
-	if resp.StatusCode == http.StatusNoContent {
-		return nil, io.ErrShortBuffer
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: func() { <-c.inFlight }}
+	return resp, nil
+}
+
+func (c *HazelcastCache) url(key string) string {
+	return fmt.Sprintf("%s/%s", c.hazelCastAPIBase, key)
+}
+
+// getOnce issues a single GET for key and returns the body if the key was found.
+func (c *HazelcastCache) getOnce(key string) (io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", c.url(key), nil)
+	if err != nil {
+		return nil, err
 	}
 
-	defer resp.Body.Close()
-	return ioutil.ReadAll(resp.Body)
+	resp, err := c.roundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNoContent:
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+
+	resp.Body.Close()
+	return nil, &StatusError{URL: req.URL.String(), StatusCode: resp.StatusCode}
 }
 
-func (c *HazelcastCache) Put(key string, b []byte) error {
-	resp, err := c.httpClient.Post(fmt.Sprintf("%s/%s", c.hazelCastAPIBase, key), "application/binary", bytes.NewReader(b))
+func (c *HazelcastCache) putOnce(key string, body io.Reader, size int64) error {
+	req, err := http.NewRequest("POST", c.url(key), body)
 	if err != nil {
-		// TODO(anupc): Retries
 		return err
 	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/binary")
 
+	resp, err := c.roundTrip(req)
+	if err != nil {
+		return err
+	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode/100 != 2 {
+		return &StatusError{URL: req.URL.String(), StatusCode: resp.StatusCode}
+	}
 	return nil
 }
 
+func (c *HazelcastCache) Get(key string) ([]byte, error) {
+	var b []byte
+	err := c.withRetries(func() error {
+		body, err := c.getOnce(key)
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+
+		b, err = ioutil.ReadAll(body)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Ping checks that the endpoint answers a GET for key within timeout. Unlike other requests it is sent only once,
+// without waiting for an in-flight slot or consulting the circuit breaker, so it reports the endpoint's current state
+// in bounded time. Whether key exists does not matter.
+func (c *HazelcastCache) Ping(key string, timeout time.Duration) error {
+	client := &http.Client{Transport: c.httpClient.Transport, Timeout: timeout}
+	resp, err := client.Get(c.url(key))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return &StatusError{URL: c.url(key), StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+func (c *HazelcastCache) Put(key string, b []byte) error {
+	return c.withRetries(func() error {
+		return c.putOnce(key, bytes.NewReader(b), int64(len(b)))
+	})
+}
+
+// Open retries until the response headers arrive; failures while reading the body are left to the caller.
+func (c *HazelcastCache) Open(key string) (io.ReadCloser, error) {
+	var body io.ReadCloser
+	err := c.withRetries(func() (err error) {
+		body, err = c.getOnce(key)
+		return err
+	})
+
+	return body, err
+}
+
+// Create spools the entry to a temporary file, since the Hazelcast REST API needs the whole value in one POST and a
+// retry has to be able to send it again.
+func (c *HazelcastCache) Create(key string) (BlobWriter, error) {
+	f, err := ioutil.TempFile("", "hazelcast-put")
+	if err != nil {
+		return nil, err
+	}
+
+	return &hazelcastBlobWriter{cache: c, key: key, f: f}, nil
+}
+
+type hazelcastBlobWriter struct {
+	cache *HazelcastCache
+	key   string
+	f     *os.File
+	size  int64
+}
+
+func (w *hazelcastBlobWriter) Write(p []byte) (int, error) {
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *hazelcastBlobWriter) Close() error {
+	defer w.Abort()
+
+	return w.cache.withRetries(func() error {
+		return w.cache.putOnce(w.key, io.NewSectionReader(w.f, 0, w.size), w.size)
+	})
+}
+
+func (w *hazelcastBlobWriter) Abort() error {
+	w.f.Close()
+	return os.Remove(w.f.Name())
+}
+
 var _ Cache = new(HazelcastCache)
+var _ StreamingCache = new(HazelcastCache)
@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// peakCounter stands in for a Hazelcast REST endpoint and records how many requests it was serving at most at once.
+// Keys ending in an odd hex digit are missing.
+type peakCounter struct {
+	lock    sync.Mutex
+	current int
+	peak    int
+}
+
+func (pc *peakCounter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	pc.lock.Lock()
+	pc.current++
+	if pc.current > pc.peak {
+		pc.peak = pc.current
+	}
+	pc.lock.Unlock()
+
+	defer func() {
+		pc.lock.Lock()
+		pc.current--
+		pc.lock.Unlock()
+	}()
+
+	time.Sleep(time.Millisecond)
+	if strings.IndexByte("13579bdf", r.URL.Path[len(r.URL.Path)-1]) >= 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Write([]byte("content"))
+}
+
+func (pc *peakCounter) Peak() int {
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+
+	return pc.peak
+}
+
+func TestHazelcastCacheMaxInFlight(t *testing.T) {
+	counter := new(peakCounter)
+	server := httptest.NewServer(counter)
+	defer server.Close()
+
+	opts := DefaultHazelcastCacheOptions
+	opts.MaxInFlight = 8
+	opts.MaxIdleConnsPerHost = 8
+	c := NewHazelcastCache(server.URL, opts)
+
+	const numKeys = 4000
+	errs := make(chan error, numKeys)
+	var wg sync.WaitGroup
+	for i := 0; i < numKeys; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			key := fmt.Sprintf("%032x", i)
+			if i%4 < 2 {
+				_, err := c.Get(key)
+				if i%2 == 1 && err != ErrNotFound {
+					errs <- fmt.Errorf("Get(%s) = %v, want ErrNotFound", key, err)
+				} else if i%2 == 0 && err != nil {
+					errs <- fmt.Errorf("Get(%s) = %v", key, err)
+				}
+				return
+			}
+
+			// Streamed reads hold their slot until the body is closed.
+			rc, err := c.Open(key)
+			if i%2 == 1 && err != ErrNotFound {
+				errs <- fmt.Errorf("Open(%s) = %v, want ErrNotFound", key, err)
+			} else if i%2 == 0 && err != nil {
+				errs <- fmt.Errorf("Open(%s) = %v", key, err)
+			} else if err == nil {
+				ioutil.ReadAll(rc)
+				rc.Close()
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+	if peak := counter.Peak(); peak > opts.MaxInFlight {
+		t.Errorf("%d requests in flight at once, want at most %d", peak, opts.MaxInFlight)
+	} else if peak < 2 {
+		t.Errorf("%d requests in flight at once, want them to run concurrently", peak)
+	}
+}
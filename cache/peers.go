@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Path under which a worker serves the contents of its DiskCache to peers.
+const PeerPathPrefix = "/cas/"
+
+var (
+	peerHits   = expvar.NewInt("cache_peer_hits")
+	peerMisses = expvar.NewInt("cache_peer_misses")
+	peerErrors = expvar.NewInt("cache_peer_errors")
+)
+
+// PeerSet locates blobs in the DiskCaches of other workers.
+type PeerSet struct {
+	peers       []string
+	probeClient *http.Client
+	fetchClient *http.Client
+}
+
+// NewPeerSet takes the base URLs of peer workers (e.g. http://worker2:1234). Peers are asked whether they have a key
+// with a HEAD request that has to complete within probeTimeout, so a slow or dead peer only delays a fetch slightly.
+func NewPeerSet(peers []string, probeTimeout time.Duration) *PeerSet {
+	return &PeerSet{
+		peers:       peers,
+		probeClient: &http.Client{Timeout: probeTimeout},
+		fetchClient: &http.Client{Transport: &http.Transport{ResponseHeaderTimeout: probeTimeout}},
+	}
+}
+
+func (ps *PeerSet) url(peer string, key string) string {
+	return fmt.Sprintf("%s%s%s", strings.TrimSuffix(peer, "/"), PeerPathPrefix, key)
+}
+
+// locate asks all peers for key at once and returns the first one that advertises it.
+func (ps *PeerSet) locate(key string) (string, bool) {
+	found := make(chan string, len(ps.peers))
+	for _, peer := range ps.peers {
+		go func(peer string) {
+			resp, err := ps.probeClient.Head(ps.url(peer, key))
+			if err != nil {
+				found <- ""
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				found <- ""
+				return
+			}
+			found <- peer
+		}(peer)
+	}
+
+	for range ps.peers {
+		if peer := <-found; peer != "" {
+			return peer, true
+		}
+	}
+	return "", false
+}
+
+// Open returns the raw file content of key from a peer that has it, or ErrNotFound.
+func (ps *PeerSet) Open(key string) (io.ReadCloser, error) {
+	peer, ok := ps.locate(key)
+	if !ok {
+		peerMisses.Add(1)
+		return nil, ErrNotFound
+	}
+
+	resp, err := ps.fetchClient.Get(ps.url(peer, key))
+	if err != nil {
+		peerMisses.Add(1)
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		peerMisses.Add(1)
+		return nil, &StatusError{URL: ps.url(peer, key), StatusCode: resp.StatusCode}
+	}
+
+	peerHits.Add(1)
+	return resp.Body, nil
+}
@@ -0,0 +1,219 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PrewarmEntry identifies a file to fetch into the DiskCache ahead of time.
+type PrewarmEntry struct {
+	Key        string
+	Executable bool
+}
+
+// ParsePrewarmManifest reads a manifest with one content key per line, optionally followed by "x" if the file
+// should be cached as executable. Empty lines and lines starting with # are ignored. Keys must be hex MD5, SHA-1 or
+// SHA-256 digests, since they end up in paths under the cache directory.
+func ParsePrewarmManifest(r io.Reader) ([]PrewarmEntry, error) {
+	var entries []PrewarmEntry
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		switch {
+		case !IsContentKey(fields[0]):
+			return nil, fmt.Errorf("line %d: %q is not a content key", lineNo, fields[0])
+		case len(fields) == 1:
+			entries = append(entries, PrewarmEntry{Key: fields[0]})
+		case len(fields) == 2 && fields[1] == "x":
+			entries = append(entries, PrewarmEntry{Key: fields[0], Executable: true})
+		default:
+			return nil, fmt.Errorf("line %d: expected \"<key> [x]\"", lineNo)
+		}
+	}
+
+	return entries, scanner.Err()
+}
+
+// WritePrewarmManifest writes entries in the format read by ParsePrewarmManifest.
+func WritePrewarmManifest(w io.Writer, entries []PrewarmEntry) error {
+	for _, entry := range entries {
+		line := entry.Key
+		if entry.Executable {
+			line += " x"
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Prewarm fetches entries into the cache, at most `concurrency` at a time, and returns once all fetches are done.
+// Entries already on disk are skipped. Prewarmed entries are not retained, so they can be evicted like any other
+// entry that has not been used recently.
+func (dc *DiskCache) Prewarm(entries []PrewarmEntry, concurrency int) (fetched int, failed int) {
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	slots := make(chan struct{}, concurrency)
+	for _, entry := range entries {
+		if dc.getState(localKey(entry.Key, entry.Executable)) == PRESENT {
+			continue
+		}
+
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(entry PrewarmEntry) {
+			err := dc.fetchKey(entry.Key, entry.Executable, 0)
+			lock.Lock()
+			if err != nil {
+				failed++
+			} else {
+				fetched++
+			}
+			lock.Unlock()
+			<-slots
+			wg.Done()
+		}(entry)
+	}
+	wg.Wait()
+
+	return fetched, failed
+}
+
+// Use counts are kept for at most maxUseCounts local keys. Once there are more, all counts are halved and those that
+// drop to zero are forgotten, so keys that were only used long ago make room for new ones.
+const maxUseCounts = 100000
+
+// Use counts are saved to this file in the cache directory, so they survive restarts.
+const useCountsFileName = "use-counts"
+
+func (dc *DiskCache) recordUse(localKey string) {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	dc.useCounts[localKey]++
+	for len(dc.useCounts) > maxUseCounts {
+		for lk, count := range dc.useCounts {
+			if count /= 2; count == 0 {
+				delete(dc.useCounts, lk)
+			} else {
+				dc.useCounts[lk] = count
+			}
+		}
+	}
+}
+
+func (dc *DiskCache) useCountsPath() string {
+	return filepath.Join(dc.cacheDir, useCountsFileName)
+}
+
+// SaveUseCounts writes the use counts to the cache directory every interval, for Load to restore after a restart.
+func (dc *DiskCache) SaveUseCounts(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		if err := dc.saveUseCounts(); err != nil {
+			log.Printf("Unable to save use counts: %s", err)
+		}
+	}
+}
+
+func (dc *DiskCache) saveUseCounts() error {
+	var buf bytes.Buffer
+	dc.lock.RLock()
+	for lk, count := range dc.useCounts {
+		fmt.Fprintf(&buf, "%s %d\n", lk, count)
+	}
+	dc.lock.RUnlock()
+
+	f, err := ioutil.TempFile(dc.tmpDir(), useCountsFileName)
+	if err != nil {
+		return err
+	}
+	if _, err := buf.WriteTo(f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), dc.useCountsPath())
+}
+
+// loadUseCounts restores the use counts last saved by SaveUseCounts, if any. Malformed lines are skipped.
+func (dc *DiskCache) loadUseCounts() error {
+	f, err := os.Open(dc.useCountsPath())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() && len(dc.useCounts) < maxUseCounts {
+		var lk string
+		var count int
+		if _, err := fmt.Sscanf(scanner.Text(), "%s %d", &lk, &count); err != nil || !isEntryName(lk) || count <= 0 {
+			continue
+		}
+		dc.useCounts[lk] = count
+	}
+	return scanner.Err()
+}
+
+type byUseCount struct {
+	keys   []string
+	counts map[string]int
+}
+
+func (b byUseCount) Len() int           { return len(b.keys) }
+func (b byUseCount) Less(i, j int) bool { return b.counts[b.keys[i]] > b.counts[b.keys[j]] }
+func (b byUseCount) Swap(i, j int)      { b.keys[i], b.keys[j] = b.keys[j], b.keys[i] }
+
+// HotEntries returns up to n of the entries requested most often through EnsureCached, most used first. Older uses
+// count for less once counts have been decayed (see maxUseCounts). Feeding them to Prewarm on a fresh worker gets it the inputs that most actions need.
+func (dc *DiskCache) HotEntries(n int) []PrewarmEntry {
+	dc.lock.RLock()
+	counts := make(map[string]int, len(dc.useCounts))
+	keys := make([]string, 0, len(dc.useCounts))
+	for lk, count := range dc.useCounts {
+		counts[lk] = count
+		keys = append(keys, lk)
+	}
+	dc.lock.RUnlock()
+
+	sort.Sort(byUseCount{keys: keys, counts: counts})
+	if n < 0 {
+		n = 0
+	}
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+
+	entries := make([]PrewarmEntry, 0, len(keys))
+	for _, lk := range keys {
+		key := strings.TrimSuffix(lk, executableSuffix)
+		entries = append(entries, PrewarmEntry{Key: key, Executable: key != lk})
+	}
+	return entries
+}
@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUseCountsAreBounded(t *testing.T) {
+	dc, cleanup := newTestDiskCache(t, newMemCache())
+	defer cleanup()
+
+	hot := fmt.Sprintf("%032x", 0)
+	for i := 0; i < 10; i++ {
+		dc.recordUse(hot)
+	}
+	for i := 1; i <= 2*maxUseCounts; i++ {
+		dc.recordUse(fmt.Sprintf("%032x", i))
+	}
+
+	if n := len(dc.useCounts); n > maxUseCounts {
+		t.Errorf("%d use counts kept, want at most %d", n, maxUseCounts)
+	}
+	if entries := dc.HotEntries(1); len(entries) != 1 || entries[0].Key != hot {
+		t.Errorf("HotEntries(1) = %v, want %s", entries, hot)
+	}
+}
+
+func TestUseCountsSurviveRestart(t *testing.T) {
+	dc, cleanup := newTestDiskCache(t, newMemCache())
+	defer cleanup()
+
+	hot, cold := fmt.Sprintf("%032x", 1), fmt.Sprintf("%032x", 2)
+	dc.recordUse(hot + executableSuffix)
+	dc.recordUse(hot + executableSuffix)
+	dc.recordUse(cold)
+	if err := dc.saveUseCounts(); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := NewDiskCache(dc.cacheDir, newMemCache())
+	if err := restarted.Load(); err != nil {
+		t.Fatal(err)
+	}
+	want := []PrewarmEntry{{Key: hot, Executable: true}, {Key: cold}}
+	if entries := restarted.HotEntries(10); fmt.Sprint(entries) != fmt.Sprint(want) {
+		t.Errorf("HotEntries(10) after restart = %v, want %v", entries, want)
+	}
+
+	if problems, err := restarted.Fsck(); err != nil || len(problems) > 0 {
+		t.Errorf("Fsck() = %v, %v", problems, err)
+	}
+}
+
+func TestParsePrewarmManifest(t *testing.T) {
+	md5Key, sha256Key := fmt.Sprintf("%032x", 1), fmt.Sprintf("%064x", 2)
+	manifest := "# comment\n\n" + md5Key + "\n" + sha256Key + " x\n"
+	entries, err := ParsePrewarmManifest(strings.NewReader(manifest))
+	want := []PrewarmEntry{{Key: md5Key}, {Key: sha256Key, Executable: true}}
+	if err != nil || fmt.Sprint(entries) != fmt.Sprint(want) {
+		t.Errorf("ParsePrewarmManifest(%q) = %v, %v, want %v", manifest, entries, err, want)
+	}
+
+	for _, manifest := range []string{
+		"../../x\n",
+		md5Key + "/../x\n",
+		md5Key + executableSuffix + "\n",
+		"abc\n",
+		strings.ToUpper(fmt.Sprintf("%032x", 0xabc)) + "\n",
+		md5Key + " y\n",
+		md5Key + " x x\n",
+	} {
+		if entries, err := ParsePrewarmManifest(strings.NewReader(manifest)); err == nil {
+			t.Errorf("ParsePrewarmManifest(%q) = %v, want an error", manifest, entries)
+		}
+	}
+}
+
+func TestHotEntriesNegativeLimit(t *testing.T) {
+	dc, cleanup := newTestDiskCache(t, newMemCache())
+	defer cleanup()
+
+	dc.recordUse(fmt.Sprintf("%032x", 1))
+	if entries := dc.HotEntries(-1); len(entries) != 0 {
+		t.Errorf("HotEntries(-1) = %v, want none", entries)
+	}
+}
@@ -0,0 +1,221 @@
+package cache
+
+import (
+	"container/list"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const RESTServerPrefix = "/hazelcast/rest/maps/"
+
+type restEntry struct {
+	path string
+	size int64
+}
+
+// RESTServer serves the subset of the Hazelcast REST map API that HazelcastCache uses (GET, POST and DELETE on
+// /hazelcast/rest/maps/<map>/<key>), storing values on local disk. Once the stored values exceed maxBytes, the least
+// recently used ones are evicted.
+type RESTServer struct {
+	dir      string
+	maxBytes int64
+
+	lock    sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // Of *restEntry, most recently used at the front
+	size    int64
+}
+
+// NewRESTServer indexes any values already stored under dir, so the store survives restarts.
+func NewRESTServer(dir string, maxBytes int64) (*RESTServer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	s := &RESTServer{
+		dir:      dir,
+		maxBytes: maxBytes,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+
+	var existing []os.FileInfo
+	paths := make(map[os.FileInfo]string)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if strings.HasPrefix(info.Name(), ".tmp-") {
+			return os.Remove(path)
+		}
+		existing = append(existing, info)
+		paths[info] = path
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Oldest first, so the most recently written values end up at the front of the LRU list.
+	sort.Sort(byModTime(existing))
+	s.lock.Lock()
+	for _, info := range existing {
+		s.add(paths[info], info.Size())
+	}
+	s.evict()
+	s.lock.Unlock()
+
+	return s, nil
+}
+
+type byModTime []os.FileInfo
+
+func (f byModTime) Len() int           { return len(f) }
+func (f byModTime) Less(i, j int) bool { return f[i].ModTime().Before(f[j].ModTime()) }
+func (f byModTime) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+
+// Must be called with lock held.
+func (s *RESTServer) add(path string, size int64) {
+	if elem, ok := s.entries[path]; ok {
+		s.size -= elem.Value.(*restEntry).size
+		s.lru.Remove(elem)
+	}
+	s.entries[path] = s.lru.PushFront(&restEntry{path: path, size: size})
+	s.size += size
+}
+
+// Must be called with lock held.
+func (s *RESTServer) remove(path string) {
+	elem, ok := s.entries[path]
+	if !ok {
+		return
+	}
+
+	s.size -= elem.Value.(*restEntry).size
+	s.lru.Remove(elem)
+	delete(s.entries, path)
+	os.Remove(path)
+}
+
+// Must be called with lock held.
+func (s *RESTServer) evict() {
+	for s.size > s.maxBytes && s.lru.Len() > 0 {
+		s.remove(s.lru.Back().Value.(*restEntry).path)
+	}
+}
+
+// entryPath maps a request path to the file holding its value.
+func (s *RESTServer) entryPath(requestPath string) (string, bool) {
+	parts := strings.SplitN(strings.TrimPrefix(requestPath, RESTServerPrefix), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", false
+	}
+
+	for i, part := range parts {
+		parts[i] = url.QueryEscape(part)
+		if parts[i] == "." || parts[i] == ".." || strings.HasPrefix(parts[i], ".tmp-") {
+			return "", false
+		}
+	}
+
+	return filepath.Join(s.dir, parts[0], parts[1]), true
+}
+
+func (s *RESTServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path, ok := s.entryPath(r.URL.Path)
+	if !ok {
+		http.Error(w, "expected "+RESTServerPrefix+"<map>/<key>", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		s.get(w, path)
+	case "POST", "PUT":
+		s.put(w, r, path)
+	case "DELETE":
+		s.lock.Lock()
+		s.remove(path)
+		s.lock.Unlock()
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *RESTServer) get(w http.ResponseWriter, path string) {
+	s.lock.Lock()
+	elem, ok := s.entries[path]
+	if ok {
+		s.lru.MoveToFront(elem)
+	}
+	s.lock.Unlock()
+
+	// Like Hazelcast, a missing key is answered with 204 rather than 404.
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/binary")
+	io.Copy(w, f)
+}
+
+func (s *RESTServer) put(w http.ResponseWriter, r *http.Request, path string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Reading one byte more than fits is enough to tell that a value is too large, without storing all of it.
+	size, err := io.Copy(f, http.MaxBytesReader(w, r.Body, s.maxBytes+1))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if size > s.maxBytes {
+		os.Remove(f.Name())
+		http.Error(w, "value larger than the store", http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		os.Remove(f.Name())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.add(path, size)
+	s.evict()
+}
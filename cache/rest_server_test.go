@@ -0,0 +1,157 @@
+package cache
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func newTestRESTServer(t *testing.T, maxBytes int64) (*RESTServer, func()) {
+	dir, err := ioutil.TempDir("", "rest_server_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewRESTServer(dir, maxBytes)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return s, func() { os.RemoveAll(dir) }
+}
+
+// do sends a request for path, which is used as is rather than parsed, to s and returns the response.
+func do(s *RESTServer, method string, path string, body string) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest(method, "http://localhost/", strings.NewReader(body))
+	r.URL.Path = path
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return w
+}
+
+func TestRESTServerGetPostDelete(t *testing.T) {
+	s, cleanup := newTestRESTServer(t, 1<<20)
+	defer cleanup()
+	path := RESTServerPrefix + "cache/key"
+
+	if w := do(s, "GET", path, ""); w.Code != http.StatusNoContent {
+		t.Errorf("GET of a missing key = %d, want %d", w.Code, http.StatusNoContent)
+	}
+
+	if w := do(s, "POST", path, "value"); w.Code != http.StatusOK {
+		t.Fatalf("POST = %d %s", w.Code, w.Body)
+	}
+	if w := do(s, "GET", path, ""); w.Code != http.StatusOK || w.Body.String() != "value" {
+		t.Errorf("GET = %d %q, want %q", w.Code, w.Body, "value")
+	}
+
+	if w := do(s, "DELETE", path, ""); w.Code != http.StatusOK {
+		t.Errorf("DELETE = %d %s", w.Code, w.Body)
+	}
+	if w := do(s, "GET", path, ""); w.Code != http.StatusNoContent {
+		t.Errorf("GET after DELETE = %d, want %d", w.Code, http.StatusNoContent)
+	}
+}
+
+func TestRESTServerThroughHazelcastCache(t *testing.T) {
+	s, cleanup := newTestRESTServer(t, 1<<20)
+	defer cleanup()
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	c := NewHazelcastCache(server.URL+RESTServerPrefix+"cache", DefaultHazelcastCacheOptions)
+	if _, err := c.Get("key"); err != ErrNotFound {
+		t.Errorf("Get of a missing key = %v, want ErrNotFound", err)
+	}
+	if err := c.Put("key", []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := c.Get("key"); err != nil || string(b) != "value" {
+		t.Errorf("Get = %q, %v, want %q", b, err, "value")
+	}
+}
+
+func TestRESTServerEvictsLeastRecentlyUsed(t *testing.T) {
+	s, cleanup := newTestRESTServer(t, 10)
+	defer cleanup()
+	a, b, c := RESTServerPrefix+"cache/a", RESTServerPrefix+"cache/b", RESTServerPrefix+"cache/c"
+
+	do(s, "POST", a, "aaaa")
+	do(s, "POST", b, "bbbb")
+	// Reading a makes b the least recently used value.
+	do(s, "GET", a, "")
+	do(s, "POST", c, "cccc")
+
+	if w := do(s, "GET", b, ""); w.Code != http.StatusNoContent {
+		t.Errorf("GET of the least recently used value = %d %q, want it evicted", w.Code, w.Body)
+	}
+	for _, path := range []string{a, c} {
+		if w := do(s, "GET", path, ""); w.Code != http.StatusOK {
+			t.Errorf("GET %s = %d, want it kept", path, w.Code)
+		}
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func TestRESTServerRejectsOversizedValues(t *testing.T) {
+	s, cleanup := newTestRESTServer(t, 10)
+	defer cleanup()
+	path := RESTServerPrefix + "cache/key"
+
+	if w := do(s, "POST", path, strings.Repeat("x", 10)); w.Code != http.StatusOK {
+		t.Errorf("POST of a value filling the store = %d %s", w.Code, w.Body)
+	}
+
+	body := &countingReader{r: strings.NewReader(strings.Repeat("x", 1<<20))}
+	r, _ := http.NewRequest("POST", "http://localhost"+path, body)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("POST of an oversized value = %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+	if body.n > 1024 {
+		t.Errorf("%d bytes of an oversized value were read, want it rejected once it exceeds the store", body.n)
+	}
+	if w := do(s, "GET", path, ""); !bytes.Equal(w.Body.Bytes(), bytes.Repeat([]byte("x"), 10)) {
+		t.Errorf("GET after rejected POST = %d %q, want the previous value", w.Code, w.Body)
+	}
+}
+
+func TestRESTServerRejectsDotDot(t *testing.T) {
+	s, cleanup := newTestRESTServer(t, 1<<20)
+	defer cleanup()
+
+	for _, path := range []string{
+		RESTServerPrefix + "../key",
+		RESTServerPrefix + "cache/..",
+		RESTServerPrefix + "./key",
+		RESTServerPrefix + "cache",
+	} {
+		if w := do(s, "POST", path, "value"); w.Code != http.StatusBadRequest {
+			t.Errorf("POST %s = %d, want %d", path, w.Code, http.StatusBadRequest)
+		}
+	}
+
+	// A key containing a slash is stored under an escaped name, inside the map's directory.
+	if w := do(s, "POST", RESTServerPrefix+"cache/../../escape", "value"); w.Code != http.StatusOK {
+		t.Fatalf("POST of a key with slashes = %d %s", w.Code, w.Body)
+	}
+	if _, err := os.Stat(s.dir + "/../escape"); !os.IsNotExist(err) {
+		t.Errorf("value was written outside the store: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy controls how many times a failed cache request is attempted and how long to wait in between.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Multiplier:     2,
+}
+
+// Backoff returns the delay before the attempt following `attempt` (1-based). The delay grows exponentially and is
+// jittered to somewhere in [d/2, d) so that workers retrying against a recovering backend do not move in lockstep.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		d *= p.Multiplier
+		if d >= float64(p.MaxBackoff) {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if d < 2 {
+		return time.Duration(d)
+	}
+
+	half := int64(d / 2)
+	return time.Duration(half + rand.Int63n(half))
+}
+
+// StatusError is returned when the cache backend answers with an unexpected HTTP status.
+type StatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: unexpected status %d %s", e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Temporary reports whether the status indicates a transient backend problem worth retrying.
+func (e *StatusError) Temporary() bool {
+	switch e.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// isRetryable classifies an error from a single request attempt. Transport errors are always retried, HTTP errors
+// only if the status is transient, and everything else (misses, circuit rejections) is returned as is.
+func isRetryable(err error) bool {
+	switch err := err.(type) {
+	case nil:
+		return false
+	case *StatusError:
+		return err.Temporary()
+	case *circuitOpenError:
+		return false
+	}
+	return err != ErrNotFound
+}
@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBackoffBounds(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 10, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2}
+
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{50, time.Second},
+	}
+	for _, test := range tests {
+		for i := 0; i < 100; i++ {
+			// Jitter puts every delay in [max/2, max).
+			if d := p.Backoff(test.attempt); d < test.max/2 || d >= test.max {
+				t.Errorf("Backoff(%d) = %s, want in [%s, %s)", test.attempt, d, test.max/2, test.max)
+				break
+			}
+		}
+	}
+
+	if d := (RetryPolicy{}).Backoff(3); d != 0 {
+		t.Errorf("Backoff without an initial backoff = %s, want 0", d)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{ErrNotFound, false},
+		{&circuitOpenError{"test"}, false},
+		{&StatusError{StatusCode: http.StatusServiceUnavailable}, true},
+		{&StatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{&StatusError{StatusCode: http.StatusGatewayTimeout}, true},
+		{&StatusError{StatusCode: http.StatusBadRequest}, false},
+		{&StatusError{StatusCode: http.StatusForbidden}, false},
+		{errors.New("connection reset by peer"), true},
+	}
+	for _, test := range tests {
+		if got := isRetryable(test.err); got != test.want {
+			t.Errorf("isRetryable(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"expvar"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const quarantineDirName = "quarantine"
+
+var (
+	scrubbedEntries    = expvar.NewInt("disk_cache_scrubbed_entries")
+	scrubbedBytes      = expvar.NewInt("disk_cache_scrubbed_bytes")
+	quarantinedEntries = expvar.NewInt("disk_cache_quarantined_entries")
+)
+
+// newHashForKey guesses the digest function a content key was computed with from its length.
+func newHashForKey(key string) hash.Hash {
+	switch len(key) {
+	case 2 * md5.Size:
+		return md5.New()
+	case 2 * sha1.Size:
+		return sha1.New()
+	case 2 * sha256.Size:
+		return sha256.New()
+	}
+	return nil
+}
+
+// throttledReader limits reads to bytesPerSecond on average.
+type throttledReader struct {
+	r              io.Reader
+	bytesPerSecond int64
+	start          time.Time
+	read           int64
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > t.bytesPerSecond && t.bytesPerSecond > 0 {
+		p = p[:t.bytesPerSecond]
+	}
+	n, err := t.r.Read(p)
+	t.read += int64(n)
+
+	if t.bytesPerSecond > 0 {
+		due := t.start.Add(time.Duration(t.read * int64(time.Second) / t.bytesPerSecond))
+		if wait := due.Sub(time.Now()); wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+	return n, err
+}
+
+func (dc *DiskCache) quarantineDir() string {
+	return filepath.Join(dc.cacheDir, quarantineDirName)
+}
+
+// Scrub continuously rehashes cached entries against their keys, reading at most bytesPerSecond from disk, and
+// pausing for interval after every full pass. Entries that do not match are moved to <cachedir>/quarantine and
+// marked MISSING so they are fetched again on next use. Keys that do not look like a known digest are skipped.
+func (dc *DiskCache) Scrub(bytesPerSecond int64, interval time.Duration) {
+	for {
+		var localKeys []string
+		dc.lock.RLock()
+		for lk, status := range dc.state {
+			if status == PRESENT {
+				localKeys = append(localKeys, lk)
+			}
+		}
+		dc.lock.RUnlock()
+
+		throttle := &throttledReader{bytesPerSecond: bytesPerSecond, start: time.Now()}
+		for _, lk := range localKeys {
+			if err := dc.scrubEntry(lk, throttle); err != nil {
+				log.Printf("Error scrubbing %s: %s", lk, err)
+			}
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+func (dc *DiskCache) scrubEntry(localKey string, throttle *throttledReader) error {
+	h := newHashForKey(strings.TrimSuffix(localKey, executableSuffix))
+	if h == nil || dc.getState(localKey) != PRESENT {
+		return nil
+	}
+
+	f, err := os.Open(dc.path(localKey))
+	if os.IsNotExist(err) {
+		// Evicted since we listed it.
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	throttle.r = f
+	n, err := io.Copy(h, throttle)
+	scrubbedBytes.Add(n)
+	if err != nil {
+		return err
+	}
+	scrubbedEntries.Add(1)
+
+	if hex.EncodeToString(h.Sum(nil)) == strings.TrimSuffix(localKey, executableSuffix) {
+		return nil
+	}
+
+	return dc.quarantine(localKey)
+}
+
+// quarantine moves a corrupt entry out of the cache and marks it MISSING.
+func (dc *DiskCache) quarantine(localKey string) error {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	if dc.state[localKey] != PRESENT {
+		return nil
+	}
+
+	if err := os.MkdirAll(dc.quarantineDir(), 0755); err != nil {
+		return err
+	}
+	dest := filepath.Join(dc.quarantineDir(), fmt.Sprintf("%s.%d", localKey, time.Now().Unix()))
+	if err := os.Rename(dc.path(localKey), dest); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	dc.state[localKey] = MISSING
+	delete(dc.keepUntil, localKey)
+	quarantinedEntries.Add(1)
+	log.Printf("Quarantined corrupt cache entry %s to %s", localKey, dest)
+	return nil
+}
@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+)
+
+type ringPoint struct {
+	hash  uint32
+	shard int
+}
+
+type hashRing []ringPoint
+
+func (r hashRing) Len() int           { return len(r) }
+func (r hashRing) Less(i, j int) bool { return r[i].hash < r[j].hash }
+func (r hashRing) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+// ShardedCache implements Cache interface by spreading keys across several backing caches using consistent hashing.
+// Each key is written to up to `replicas` distinct shards, and reads fall back to the next replica if a shard fails.
+type ShardedCache struct {
+	shards   []Cache
+	ring     hashRing
+	replicas int
+}
+
+// NewShardedCache builds a hash ring with virtualNodes points per shard. Shards are identified on the ring by their
+// name (typically the endpoint URL), so adding or removing a shard only remaps the keys that shard owns.
+func NewShardedCache(shards map[string]Cache, virtualNodes int, replicas int) *ShardedCache {
+	if virtualNodes < 1 {
+		virtualNodes = 1
+	}
+
+	names := make([]string, 0, len(shards))
+	for name := range shards {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sc := &ShardedCache{}
+	for i, name := range names {
+		sc.shards = append(sc.shards, shards[name])
+		for v := 0; v < virtualNodes; v++ {
+			sc.ring = append(sc.ring, ringPoint{
+				hash:  crc32.ChecksumIEEE([]byte(fmt.Sprintf("%s#%d", name, v))),
+				shard: i,
+			})
+		}
+	}
+	sort.Sort(sc.ring)
+
+	sc.replicas = replicas
+	if sc.replicas < 1 {
+		sc.replicas = 1
+	}
+	if sc.replicas > len(sc.shards) {
+		sc.replicas = len(sc.shards)
+	}
+
+	return sc
+}
+
+// shardsFor returns the indices of the shards responsible for key, primary first.
+func (sc *ShardedCache) shardsFor(key string) []int {
+	if len(sc.ring) == 0 {
+		return nil
+	}
+
+	h := crc32.ChecksumIEEE([]byte(key))
+	start := sort.Search(len(sc.ring), func(i int) bool { return sc.ring[i].hash >= h })
+
+	owners := make([]int, 0, sc.replicas)
+	seen := make(map[int]bool)
+	for i := 0; i < len(sc.ring) && len(owners) < sc.replicas; i++ {
+		point := sc.ring[(start+i)%len(sc.ring)]
+		if !seen[point.shard] {
+			seen[point.shard] = true
+			owners = append(owners, point.shard)
+		}
+	}
+
+	return owners
+}
+
+func (sc *ShardedCache) Get(key string) ([]byte, error) {
+	err := fmt.Errorf("no cache shards configured")
+	for _, shard := range sc.shardsFor(key) {
+		var b []byte
+		if b, err = sc.shards[shard].Get(key); err == nil {
+			return b, nil
+		}
+	}
+
+	return nil, err
+}
+
+// Put writes to every replica of key. It only fails if none of the replicas accepted the write.
+func (sc *ShardedCache) Put(key string, b []byte) error {
+	err := fmt.Errorf("no cache shards configured")
+	written := false
+	for _, shard := range sc.shardsFor(key) {
+		if putErr := sc.shards[shard].Put(key, b); putErr != nil {
+			err = putErr
+		} else {
+			written = true
+		}
+	}
+
+	if written {
+		return nil
+	}
+	return err
+}
+
+func (sc *ShardedCache) Open(key string) (io.ReadCloser, error) {
+	err := fmt.Errorf("no cache shards configured")
+	for _, shard := range sc.shardsFor(key) {
+		var rc io.ReadCloser
+		if rc, err = OpenStream(sc.shards[shard], key); err == nil {
+			return rc, nil
+		}
+	}
+
+	return nil, err
+}
+
+// Create streams the entry to every replica of key at once.
+func (sc *ShardedCache) Create(key string) (BlobWriter, error) {
+	w := &multiBlobWriter{err: fmt.Errorf("no cache shards configured")}
+	for _, shard := range sc.shardsFor(key) {
+		if bw, err := CreateStream(sc.shards[shard], key); err != nil {
+			w.err = err
+		} else {
+			w.writers = append(w.writers, bw)
+		}
+	}
+
+	if len(w.writers) == 0 {
+		return nil, w.err
+	}
+	return w, nil
+}
+
+var _ Cache = new(ShardedCache)
+var _ StreamingCache = new(ShardedCache)
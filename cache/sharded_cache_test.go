@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+var errUnavailable = errors.New("unavailable")
+
+// failingCache is a Cache whose every operation fails.
+type failingCache struct{}
+
+func (failingCache) Get(string) ([]byte, error) { return nil, errUnavailable }
+func (failingCache) Put(string, []byte) error   { return errUnavailable }
+
+func newTestShards(names ...string) map[string]Cache {
+	shards := make(map[string]Cache)
+	for _, name := range names {
+		shards[name] = newMemCache()
+	}
+	return shards
+}
+
+// primaries returns the shard that owns each of numKeys keys.
+func primaries(sc *ShardedCache, numKeys int) []Cache {
+	owners := make([]Cache, numKeys)
+	for i := range owners {
+		owners[i] = sc.shards[sc.shardsFor(fmt.Sprintf("%032x", i))[0]]
+	}
+	return owners
+}
+
+func TestShardedCacheSpreadsKeys(t *testing.T) {
+	shards := newTestShards("http://a", "http://b", "http://c", "http://d")
+	sc := NewShardedCache(shards, 64, 1)
+
+	const numKeys = 10000
+	perShard := make(map[Cache]int)
+	for _, owner := range primaries(sc, numKeys) {
+		perShard[owner]++
+	}
+
+	for name, shard := range shards {
+		// Perfectly even would be 25% each.
+		if n := perShard[shard]; n < numKeys/8 || n > numKeys/2 {
+			t.Errorf("%s owns %d of %d keys", name, n, numKeys)
+		}
+	}
+}
+
+func TestShardedCacheAddingShardRemapsFewKeys(t *testing.T) {
+	shards := newTestShards("http://a", "http://b", "http://c", "http://d")
+	before := primaries(NewShardedCache(shards, 64, 1), 10000)
+
+	shards["http://e"] = newMemCache()
+	after := primaries(NewShardedCache(shards, 64, 1), 10000)
+
+	moved := 0
+	for i := range before {
+		if before[i] != after[i] {
+			moved++
+			if after[i] != shards["http://e"] {
+				t.Errorf("key %d moved between existing shards", i)
+			}
+		}
+	}
+	// The new shard should take over about a fifth of the keys.
+	if moved < len(before)/10 || moved > len(before)*3/10 {
+		t.Errorf("%d of %d keys moved, want about %d", moved, len(before), len(before)/5)
+	}
+}
+
+func TestShardedCacheReplicaFallback(t *testing.T) {
+	for _, primaryFails := range []bool{false, true} {
+		shards := newTestShards("http://a", "http://b")
+		sc := NewShardedCache(shards, 16, 2)
+		key := fmt.Sprintf("%032x", 1)
+
+		if err := sc.Put(key, []byte("content")); err != nil {
+			t.Fatal(err)
+		}
+		if primaryFails {
+			sc.shards[sc.shardsFor(key)[0]] = failingCache{}
+		} else {
+			sc.shards[sc.shardsFor(key)[1]] = failingCache{}
+		}
+
+		if b, err := sc.Get(key); err != nil || string(b) != "content" {
+			t.Errorf("primary fails: %v: Get(%s) = %q, %v", primaryFails, key, b, err)
+		}
+		if rc, err := sc.Open(key); err != nil {
+			t.Errorf("primary fails: %v: Open(%s) = %v", primaryFails, key, err)
+		} else {
+			rc.Close()
+		}
+	}
+}
+
+func TestShardedCachePutToFailingReplica(t *testing.T) {
+	shards := map[string]Cache{"http://a": newMemCache(), "http://b": failingCache{}}
+	sc := NewShardedCache(shards, 16, 2)
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("%032x", i)
+		if err := sc.Put(key, []byte("content")); err != nil {
+			t.Errorf("Put(%s) = %v, want success on the healthy replica", key, err)
+		}
+		if b, err := sc.Get(key); err != nil || string(b) != "content" {
+			t.Errorf("Get(%s) = %q, %v", key, b, err)
+		}
+	}
+
+	sc = NewShardedCache(map[string]Cache{"http://a": failingCache{}, "http://b": failingCache{}}, 16, 2)
+	if err := sc.Put(fmt.Sprintf("%032x", 0), []byte("content")); err != errUnavailable {
+		t.Errorf("Put with every replica failing = %v, want %v", err, errUnavailable)
+	}
+}
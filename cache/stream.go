@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+)
+
+// BlobWriter receives the contents of a new cache entry. Close commits the entry, Abort discards everything written.
+type BlobWriter interface {
+	io.WriteCloser
+	Abort() error
+}
+
+// StreamingCache is implemented by caches that can transfer entries without holding them fully in memory.
+type StreamingCache interface {
+	Open(string) (io.ReadCloser, error)
+	Create(string) (BlobWriter, error)
+}
+
+// OpenStream opens key for reading, streaming it if c supports that and loading it with Get otherwise.
+func OpenStream(c Cache, key string) (io.ReadCloser, error) {
+	if sc, ok := c.(StreamingCache); ok {
+		return sc.Open(key)
+	}
+
+	b, err := c.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(b)), nil
+}
+
+// CreateStream starts a new entry for key, streaming it if c supports that and buffering it for a Put otherwise.
+func CreateStream(c Cache, key string) (BlobWriter, error) {
+	if sc, ok := c.(StreamingCache); ok {
+		return sc.Create(key)
+	}
+
+	return &bufferedBlobWriter{cache: c, key: key}, nil
+}
+
+type bufferedBlobWriter struct {
+	bytes.Buffer
+	cache Cache
+	key   string
+}
+
+func (w *bufferedBlobWriter) Close() error {
+	return w.cache.Put(w.key, w.Bytes())
+}
+
+func (w *bufferedBlobWriter) Abort() error {
+	w.Reset()
+	return nil
+}
+
+// multiBlobWriter writes the same entry to several caches. Writers that fail are aborted and dropped; the entry is
+// committed as long as at least one of them succeeds.
+type multiBlobWriter struct {
+	writers []BlobWriter
+	err     error
+}
+
+func (w *multiBlobWriter) Write(p []byte) (int, error) {
+	live := w.writers[:0]
+	for _, bw := range w.writers {
+		if _, err := bw.Write(p); err != nil {
+			w.err = err
+			bw.Abort()
+			continue
+		}
+		live = append(live, bw)
+	}
+	w.writers = live
+
+	if len(w.writers) == 0 {
+		return 0, w.err
+	}
+	return len(p), nil
+}
+
+func (w *multiBlobWriter) Close() error {
+	committed := false
+	for _, bw := range w.writers {
+		if err := bw.Close(); err != nil {
+			w.err = err
+		} else {
+			committed = true
+		}
+	}
+
+	if committed {
+		return nil
+	}
+	return w.err
+}
+
+func (w *multiBlobWriter) Abort() error {
+	for _, bw := range w.writers {
+		bw.Abort()
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"runtime"
+	"strings"
+
+	"github.com/anupcshan/bazel-build-worker/cache"
+	"github.com/anupcshan/bazel-build-worker/remote"
+)
+
+const capabilitiesPath = "/capabilities"
+
+// Bumped on incompatible changes to the worker protocol.
+const protocolVersion = 1
+
+// Content keys of inputs must be computed with one of these. Outputs are always keyed by MD5.
+var supportedDigestFunctions = []string{"MD5"}
+
+func workerPlatform() map[string]string {
+	return map[string]string{
+		"OSFamily": runtime.GOOS,
+		"arch":     runtime.GOARCH,
+	}
+}
+
+func (bh *BuildRequestHandler) capabilities() *remote.WorkerCapabilities {
+	return &remote.WorkerCapabilities{
+		ProtocolVersion:      protocolVersion,
+		DigestFunctions:      supportedDigestFunctions,
+		CacheCompression:     *cacheCompression,
+		MaxInlineOutput:      *maxInlineOutput,
+		MaxConcurrentActions: int32(cap(bh.executionSlots)),
+		FreeExecutionSlots:   int32(cap(bh.executionSlots) - len(bh.executionSlots)),
+		Platform:             workerPlatform(),
+		ExecutionModes:       []string{"sync", "async", "batch"},
+	}
+}
+
+// HandleCapabilities reports the WorkerCapabilities, as protobuf or JSON depending on the Accept header.
+func (bh *BuildRequestHandler) HandleCapabilities(w http.ResponseWriter, r *http.Request) {
+	format := responseFormat(r.Header.Get("Accept"), protoFormat)
+	b, err := format.marshal(bh.capabilities())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.contentType())
+	w.Write(b)
+}
+
+// validateRequest rejects requests this worker cannot run as they are, rather than running them wrongly.
+func validateRequest(workReq *remote.RemoteWorkRequest) error {
+	if len(workReq.Arguments) == 0 {
+		return &workError{remote.ErrorCategory_INVALID_REQUEST, fmt.Errorf("no command given in arguments")}
+	}
+
+	if digestFunction := workReq.DigestFunction; digestFunction != "" {
+		supported := false
+		for _, f := range supportedDigestFunctions {
+			supported = supported || strings.EqualFold(f, digestFunction)
+		}
+		if !supported {
+			return &workError{remote.ErrorCategory_INVALID_REQUEST, fmt.Errorf("unsupported digest function %q, supported: %s", digestFunction, strings.Join(supportedDigestFunctions, ", "))}
+		}
+	}
+
+	platform := workerPlatform()
+	for name, value := range workReq.GetPlatform() {
+		if have, ok := platform[name]; !ok {
+			return &workError{remote.ErrorCategory_INVALID_REQUEST, fmt.Errorf("unsupported platform property %q", name)}
+		} else if have != value {
+			return &workError{remote.ErrorCategory_INVALID_REQUEST, fmt.Errorf("platform property %q is %q on this worker, not %q", name, have, value)}
+		}
+	}
+
+	// Inputs are staged and outputs collected under paths given by the client, so a request can only be run if they
+	// stay inside the workdir and do not clash.
+	inputPaths := make(map[string]bool)
+	for _, inputFile := range workReq.GetInputFiles() {
+		if !cache.IsContentKey(inputFile.ContentKey) {
+			return &workError{remote.ErrorCategory_INVALID_REQUEST, fmt.Errorf("input file %q: %q is not a content key", inputFile.Path, inputFile.ContentKey)}
+		} else if err := validatePath(inputFile.Path); err != nil {
+			return &workError{remote.ErrorCategory_INVALID_REQUEST, fmt.Errorf("input file %s", err)}
+		} else if inputPaths[inputFile.Path] {
+			return &workError{remote.ErrorCategory_INVALID_REQUEST, fmt.Errorf("input file %q given more than once", inputFile.Path)}
+		}
+		inputPaths[inputFile.Path] = true
+	}
+	for _, inputFile := range workReq.GetInputFiles() {
+		if dir := inputParent(inputPaths, inputFile.Path); dir != "" {
+			return &workError{remote.ErrorCategory_INVALID_REQUEST, fmt.Errorf("input file %q is inside input file %q", inputFile.Path, dir)}
+		}
+	}
+	for _, outputFile := range workReq.GetOutputFiles() {
+		if err := validatePath(outputFile.Path); err != nil {
+			return &workError{remote.ErrorCategory_INVALID_REQUEST, fmt.Errorf("output file %s", err)}
+		} else if dir := inputParent(inputPaths, outputFile.Path); dir != "" {
+			return &workError{remote.ErrorCategory_INVALID_REQUEST, fmt.Errorf("output file %q is inside input file %q", outputFile.Path, dir)}
+		}
+	}
+
+	return nil
+}
+
+// validatePath checks that p is a clean relative path that does not leave the directory it is relative to.
+func validatePath(p string) error {
+	if p == "" || p == "." || path.IsAbs(p) || path.Clean(p) != p || p == ".." || strings.HasPrefix(p, "../") {
+		return fmt.Errorf("%q is not a clean relative path inside the workdir", p)
+	}
+	return nil
+}
+
+// inputParent returns the directory of p that is also an input file, if any.
+func inputParent(inputPaths map[string]bool, p string) string {
+	for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+		if inputPaths[dir] {
+			return dir
+		}
+	}
+	return ""
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/anupcshan/bazel-build-worker/remote"
+)
+
+func TestValidateRequestPaths(t *testing.T) {
+	key := strings.Repeat("0", 32)
+	for _, tc := range []struct {
+		inputs  []string
+		outputs []string
+		valid   bool
+	}{
+		{[]string{"a/b", "a/c"}, []string{"a/d", "out/e"}, true},
+		{[]string{"a", "a"}, nil, false},
+		{[]string{"a", "a/b"}, nil, false},
+		{[]string{"a"}, []string{"a/b"}, false},
+		{[]string{"../a"}, nil, false},
+		{[]string{"a/../../b"}, nil, false},
+		{[]string{"/etc/passwd"}, nil, false},
+		{[]string{""}, nil, false},
+		{[]string{"./a"}, nil, false},
+		{nil, []string{".."}, false},
+		{nil, []string{"/tmp/out"}, false},
+		{[]string{"..a"}, []string{"..b"}, true},
+	} {
+		workReq := &remote.RemoteWorkRequest{Arguments: []string{"true"}}
+		for _, p := range tc.inputs {
+			workReq.InputFiles = append(workReq.InputFiles, &remote.FileEntry{Path: p, ContentKey: key})
+		}
+		for _, p := range tc.outputs {
+			workReq.OutputFiles = append(workReq.OutputFiles, &remote.FileEntry{Path: p})
+		}
+
+		err := validateRequest(workReq)
+		if tc.valid && err != nil {
+			t.Errorf("inputs %q, outputs %q: %s", tc.inputs, tc.outputs, err)
+		} else if !tc.valid && (err == nil || errorCategory(err) != remote.ErrorCategory_INVALID_REQUEST) {
+			t.Errorf("inputs %q, outputs %q: got %v, want INVALID_REQUEST", tc.inputs, tc.outputs, err)
+		}
+	}
+}
+
+func TestValidateRequestContentKeys(t *testing.T) {
+	for _, key := range []string{"", "../../etc/passwd", strings.Repeat("0", 31), strings.Repeat("A", 32)} {
+		workReq := &remote.RemoteWorkRequest{
+			Arguments:  []string{"true"},
+			InputFiles: []*remote.FileEntry{{Path: "a", ContentKey: key}},
+		}
+		if err := validateRequest(workReq); err == nil || errorCategory(err) != remote.ErrorCategory_INVALID_REQUEST {
+			t.Errorf("key %q: got %v, want INVALID_REQUEST", key, err)
+		}
+	}
+}
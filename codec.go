@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"strings"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+)
+
+// wireFormat is the encoding of work requests and responses on the wire.
+type wireFormat int
+
+const (
+	protoFormat wireFormat = iota // Binary protobuf, the default
+	jsonFormat  wireFormat = iota // Protobuf JSON mapping, for curl and non-Go clients
+)
+
+const (
+	protoContentType = "application/x-protobuf"
+	jsonContentType  = "application/json"
+)
+
+func formatForMediaType(mediaType string) (wireFormat, bool) {
+	switch mediaType {
+	case jsonContentType:
+		return jsonFormat, true
+	case protoContentType, "application/protobuf", "application/octet-stream":
+		return protoFormat, true
+	}
+	return protoFormat, false
+}
+
+// requestFormat returns the format of a request body with the given Content-Type. Anything but JSON is assumed to
+// be binary protobuf, as that is what clients sent before content negotiation existed.
+func requestFormat(contentType string) wireFormat {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return protoFormat
+	}
+	format, _ := formatForMediaType(mediaType)
+	return format
+}
+
+// responseFormat returns the first format listed in the Accept header, or the request format if none is listed.
+func responseFormat(accept string, requestFormat wireFormat) wireFormat {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if format, ok := formatForMediaType(mediaType); ok {
+			return format
+		}
+	}
+	return requestFormat
+}
+
+func (f wireFormat) contentType() string {
+	if f == jsonFormat {
+		return jsonContentType
+	}
+	return protoContentType
+}
+
+// streamContentType is the Content-Type of a stream of messages written with writeDelimited.
+func (f wireFormat) streamContentType() string {
+	if f == jsonFormat {
+		return "application/x-ndjson"
+	}
+	return "application/x-protobuf; delimited=true"
+}
+
+// writeDelimited writes pb so that several messages can follow each other on one stream: as one line of JSON, or
+// as binary protobuf prefixed by its varint-encoded length.
+func (f wireFormat) writeDelimited(w io.Writer, pb proto.Message) error {
+	b, err := f.marshal(pb)
+	if err != nil {
+		return err
+	}
+	if f == protoFormat {
+		b = append(proto.EncodeVarint(uint64(len(b))), b...)
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func (f wireFormat) unmarshal(b []byte, pb proto.Message) error {
+	if f == jsonFormat {
+		return jsonpb.Unmarshal(bytes.NewReader(b), pb)
+	}
+	return proto.Unmarshal(b, pb)
+}
+
+func (f wireFormat) marshal(pb proto.Message) ([]byte, error) {
+	if f == jsonFormat {
+		var buf bytes.Buffer
+		if err := new(jsonpb.Marshaler).Marshal(&buf, pb); err != nil {
+			return nil, err
+		}
+		buf.WriteByte('\n')
+		return buf.Bytes(), nil
+	}
+	return proto.Marshal(pb)
+}
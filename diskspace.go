@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/anupcshan/bazel-build-worker/cache"
+)
+
+type diskUsage struct {
+	Path       string  `json:"path"`
+	TotalBytes uint64  `json:"total_bytes"`
+	FreeBytes  uint64  `json:"free_bytes"`
+	Used       float64 `json:"used_fraction"`
+	device     uint64
+}
+
+func statDisk(path string) (diskUsage, error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return diskUsage{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return diskUsage{}, err
+	}
+
+	usage := diskUsage{
+		Path:       path,
+		TotalBytes: fs.Blocks * uint64(fs.Bsize),
+		FreeBytes:  fs.Bavail * uint64(fs.Bsize),
+	}
+	if usage.TotalBytes > 0 {
+		usage.Used = 1 - float64(usage.FreeBytes)/float64(usage.TotalBytes)
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		usage.device = uint64(st.Dev)
+	}
+	return usage, nil
+}
+
+// diskMonitor periodically checks free space on --workdir-root and --cachedir. When the file system holding the
+// cache is used beyond highWatermark, cache entries are evicted until usage drops to lowWatermark. When any of the
+// paths is used beyond criticalWatermark, the worker stops accepting new requests until space is freed up.
+type diskMonitor struct {
+	workdirRoot       string
+	cacheDir          string
+	diskCache         *cache.DiskCache
+	highWatermark     float64
+	lowWatermark      float64
+	criticalWatermark float64
+
+	lock     sync.RWMutex
+	usage    []diskUsage
+	critical bool
+}
+
+func (dm *diskMonitor) run(interval time.Duration) {
+	for {
+		dm.check()
+		time.Sleep(interval)
+	}
+}
+
+func (dm *diskMonitor) check() {
+	cacheUsage, err := statDisk(dm.cacheDir)
+	if err != nil {
+		log.Println("Unable to check free space:", err)
+		return
+	}
+	workdirUsage, err := statDisk(dm.workdirRoot)
+	if err != nil {
+		log.Println("Unable to check free space:", err)
+		return
+	}
+
+	if cacheUsage.Used > dm.highWatermark {
+		toFree := int64((cacheUsage.Used - dm.lowWatermark) * float64(cacheUsage.TotalBytes))
+		freed, err := dm.diskCache.Evict(toFree)
+		if err != nil {
+			log.Println("Error evicting cache entries:", err)
+		}
+		if freed > 0 {
+			log.Printf("%s is %.1f%% full, evicted %d bytes of cache entries", dm.cacheDir, 100*cacheUsage.Used, freed)
+		}
+
+		if cacheUsage, err = statDisk(dm.cacheDir); err != nil {
+			log.Println("Unable to check free space:", err)
+			return
+		}
+		if workdirUsage.device == cacheUsage.device {
+			workdirUsage, _ = statDisk(dm.workdirRoot)
+		}
+	}
+
+	critical := cacheUsage.Used > dm.criticalWatermark || workdirUsage.Used > dm.criticalWatermark
+
+	dm.lock.Lock()
+	defer dm.lock.Unlock()
+
+	if critical != dm.critical {
+		log.Printf("Disk space critical: %t (%s %.1f%% full, %s %.1f%% full)", critical,
+			cacheUsage.Path, 100*cacheUsage.Used, workdirUsage.Path, 100*workdirUsage.Used)
+	}
+	dm.usage = []diskUsage{workdirUsage, cacheUsage}
+	dm.critical = critical
+}
+
+// Critical reports whether new requests should be turned away for lack of disk space.
+func (dm *diskMonitor) Critical() bool {
+	dm.lock.RLock()
+	defer dm.lock.RUnlock()
+
+	return dm.critical
+}
+
+func (dm *diskMonitor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	dm.lock.RLock()
+	status := struct {
+		Disks    []diskUsage `json:"disks"`
+		Critical bool        `json:"critical"`
+	}{dm.usage, dm.critical}
+	dm.lock.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/anupcshan/bazel-build-worker/cache"
+	"github.com/anupcshan/bazel-build-worker/remote"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// workError is a failure to execute a work request, classified so clients can tell whether to retry the request,
+// run the action elsewhere or report its failure.
+type workError struct {
+	category remote.ErrorCategory
+	err      error
+}
+
+func (e *workError) Error() string {
+	return e.err.Error()
+}
+
+// Non-standard status, borrowed from nginx, for requests cancelled by the client before they completed.
+const statusClientClosedRequest = 499
+
+// HTTP status each category of error is reported with. Action failures are a successful execution as far as the
+// worker is concerned, hence 200.
+var categoryStatus = map[remote.ErrorCategory]int{
+	remote.ErrorCategory_ACTION_FAILED:   http.StatusOK,
+	remote.ErrorCategory_MISSING_INPUT:   http.StatusPreconditionFailed,
+	remote.ErrorCategory_INFRASTRUCTURE:  http.StatusInternalServerError,
+	remote.ErrorCategory_TIMEOUT:         http.StatusGatewayTimeout,
+	remote.ErrorCategory_OVERLOADED:      http.StatusServiceUnavailable,
+	remote.ErrorCategory_INVALID_REQUEST: http.StatusBadRequest,
+	remote.ErrorCategory_CANCELLED:       statusClientClosedRequest,
+}
+
+// Categories of errors where sending the same request again, possibly to another worker, may succeed.
+var retryableCategories = map[remote.ErrorCategory]bool{
+	remote.ErrorCategory_MISSING_INPUT:  true,
+	remote.ErrorCategory_INFRASTRUCTURE: true,
+	remote.ErrorCategory_OVERLOADED:     true,
+}
+
+// errorCategory returns the category of err. Errors that were not classified are the worker's fault.
+func errorCategory(err error) remote.ErrorCategory {
+	if we, ok := err.(*workError); ok {
+		return we.category
+	}
+	return remote.ErrorCategory_INFRASTRUCTURE
+}
+
+// recordError records err, if not nil, in workRes and returns the HTTP status workRes should be reported with.
+func recordError(workRes *remote.RemoteWorkResponse, err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+
+	category := errorCategory(err)
+	workRes.Exception = err.Error()
+	workRes.Success = false
+	workRes.ErrorCategory = category
+	workRes.Retryable = retryableCategories[category]
+	return categoryStatus[category]
+}
+
+// missingInputsError records in workRes that the request cannot run until the client uploads the given input files.
+// The keys are dropped from the negative cache, so the client's retry after uploading them is not turned away.
+func (bh *BuildRequestHandler) missingInputsError(workRes *remote.RemoteWorkResponse, keys []string) error {
+	bh.diskCache.ForgetMissing(keys...)
+
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if !seen[key] {
+			seen[key] = true
+			workRes.MissingInputKeys = append(workRes.MissingInputKeys, key)
+		}
+	}
+	sort.Strings(workRes.MissingInputKeys)
+
+	return &workError{remote.ErrorCategory_MISSING_INPUT, fmt.Errorf("missing input files in cache: %s", strings.Join(workRes.MissingInputKeys, ", "))}
+}
+
+// stagingError classifies an error creating a file or directory in the workdir. validateRequest turns away requests
+// whose paths clash, so only paths too long for the file system are the request's fault here.
+func stagingError(err error) error {
+	var errno error
+	switch e := err.(type) {
+	case *os.PathError:
+		errno = e.Err
+	case *os.LinkError:
+		errno = e.Err
+	}
+	if errno == syscall.ENAMETOOLONG {
+		return &workError{remote.ErrorCategory_INVALID_REQUEST, err}
+	}
+	return err
+}
+
+func linkCachedObject(relPath string, workDir string, cachePath string) error {
+	filePath := filepath.Join(workDir, relPath)
+
+	dir := path.Dir(filePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	return os.Symlink(cachePath, filePath)
+}
+
+func uploadFile(c cache.Cache, key string, filePath string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	return cache.PutEntry(c, key, f, info.Size())
+}
+
+func writeActionCacheEntry(c cache.Cache, key string, cacheEntry *remote.CacheEntry) error {
+	b, err := proto.Marshal(cacheEntry)
+	if err != nil {
+		return err
+	}
+
+	return c.Put(key, b)
+}
+
+// runCommand runs cmd, killing its whole process group if ctx is cancelled first.
+func runCommand(ctx context.Context, cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-ctx.Done():
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		case <-finished:
+		}
+	}()
+
+	return cmd.Wait()
+}
+
+// storeOutputLogs stores the complete logs of a finished command in the cache, and fills in its output in workRes.
+// Outputs beyond --max-inline-output are only previewed in workRes, clients fetch the rest from the cache.
+func (bh *BuildRequestHandler) storeOutputLogs(logger *log.Logger, workRes *remote.RemoteWorkResponse, stdout *outputLog, stderr *outputLog) {
+	workRes.StdoutKey = bh.storeOutputLog(logger, stdout)
+	workRes.StderrKey = bh.storeOutputLog(logger, stderr)
+	workRes.Out, workRes.OutTruncated = inlineOutputLog(stdout, workRes.StdoutKey)
+	workRes.Err, workRes.ErrTruncated = inlineOutputLog(stderr, workRes.StderrKey)
+}
+
+// inlineOutputLog returns l for inclusion in a response, given the key it was stored under. If storing it failed,
+// a short preview would leave the client with nothing else to go on, so as much as --max-inline-output allows is
+// inlined instead.
+func inlineOutputLog(l *outputLog, key string) (string, bool) {
+	if key == "" {
+		return l.Head(*maxInlineOutput), l.Size() > *maxInlineOutput
+	}
+	return l.Inline(*maxInlineOutput, *outputPreviewBytes)
+}
+
+// fetchInputs makes sure the given input files are in the disk cache, fetching up to parallelism of them at a time.
+// It returns the keys missing from the backing cache, and the last error other than that.
+func fetchInputs(diskCache *cache.DiskCache, inputFiles []*remote.FileEntry, parallelism int) ([]string, error) {
+	var wg sync.WaitGroup
+	var fetchLock sync.Mutex
+	var missing []string
+	var fetchErr error
+	fetchSlots := make(chan struct{}, parallelism)
+	for _, inputFile := range inputFiles {
+		fetchSlots <- struct{}{}
+		wg.Add(1)
+		go func(key string, executable bool) {
+			err := <-diskCache.EnsureCached(key, executable, 10*time.Minute)
+			fetchLock.Lock()
+			if err == cache.ErrNotFound {
+				missing = append(missing, key)
+			} else if err != nil {
+				fetchErr = err
+			}
+			fetchLock.Unlock()
+			<-fetchSlots
+			wg.Done()
+		}(inputFile.ContentKey, inputFile.Executable)
+	}
+	wg.Wait()
+
+	return missing, fetchErr
+}
+
+func (bh *BuildRequestHandler) storeOutputLog(logger *log.Logger, l *outputLog) string {
+	key, err := l.Key()
+	if err != nil {
+		logger.Println("Unable to hash output log:", err)
+		return ""
+	} else if key == "" {
+		return ""
+	}
+
+	if err := uploadFile(bh.backingCache, key, l.f.Name()); err != nil {
+		logger.Println("Unable to store output log:", err)
+		return ""
+	}
+	bh.diskCache.ForgetMissing(key)
+	return key
+}
+
+// execute stages the inputs of workReq into a fresh workdir, runs its command and uploads its outputs. It does not
+// depend on the transport the request arrived over. The command is killed if ctx is cancelled, and its output can be
+// followed under logsPrefix with id while it runs. The returned response is always filled in as far as execution got;
+// if err is not nil, recordError classifies it.
+func (bh *BuildRequestHandler) execute(ctx context.Context, id string, logger *log.Logger, workReq *remote.RemoteWorkRequest) (*remote.RemoteWorkResponse, error) {
+	workRes := new(remote.RemoteWorkResponse)
+
+	if err := validateRequest(workReq); err != nil {
+		return workRes, err
+	}
+
+	if bh.diskMonitor.Critical() {
+		return workRes, &workError{remote.ErrorCategory_OVERLOADED, fmt.Errorf("worker is out of disk space")}
+	}
+
+	workDir, err := ioutil.TempDir(*workdirRoot, "workdir")
+	if err != nil {
+		return workRes, err
+	}
+
+	// Inputs are symlinked into the workdir, so they must stay on disk for as long as it exists, however long the
+	// action runs.
+	for _, inputFile := range workReq.GetInputFiles() {
+		bh.diskCache.Pin(inputFile.ContentKey, inputFile.Executable)
+	}
+
+	logger.Println("Creating workdir:", workDir)
+	defer func(start time.Time) {
+		os.RemoveAll(workDir)
+		for _, inputFile := range workReq.GetInputFiles() {
+			bh.diskCache.Unpin(inputFile.ContentKey, inputFile.Executable)
+		}
+		logger.Printf("Completed request in %s", time.Since(start))
+	}(time.Now())
+
+	cacheStart := time.Now()
+	missingInputs, fetchErr := fetchInputs(bh.diskCache, workReq.GetInputFiles(), *maxFetchesPerRequest)
+	logger.Printf("Completed caching input files in %s", time.Since(cacheStart))
+
+	if len(missingInputs) > 0 {
+		return workRes, bh.missingInputsError(workRes, missingInputs)
+	} else if fetchErr != nil {
+		return workRes, fetchErr
+	}
+
+	for _, inputFile := range workReq.GetInputFiles() {
+		if err := linkCachedObject(inputFile.Path, workDir, bh.diskCache.GetLink(inputFile.ContentKey, inputFile.Executable)); err != nil {
+			return workRes, stagingError(err)
+		}
+	}
+
+	// Most actions expect directories for output files to exist up front.
+	for _, outputFile := range workReq.GetOutputFiles() {
+		filePath := filepath.Join(workDir, outputFile.Path)
+
+		dir := path.Dir(filePath)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return workRes, stagingError(err)
+		}
+	}
+
+	stdout, err := newOutputLog(*workdirRoot, "stdout")
+	if err != nil {
+		return workRes, err
+	}
+	defer stdout.Remove()
+	stderr, err := newOutputLog(*workdirRoot, "stderr")
+	if err != nil {
+		return workRes, err
+	}
+	defer stderr.Remove()
+
+	bh.logs.register(id, stdout, stderr)
+	defer bh.logs.unregister(id, stdout)
+
+	// Only the command itself occupies an execution slot, staging and uploads do not.
+	select {
+	case bh.executionSlots <- struct{}{}:
+	case <-ctx.Done():
+		return workRes, &workError{remote.ErrorCategory_CANCELLED, fmt.Errorf("cancelled before execution")}
+	}
+
+	cmd := exec.Command(workReq.Arguments[0], workReq.Arguments[1:]...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.Dir = workDir
+	// Run the action in its own process group, so cancelling it also kills any children that hold stdout open.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	env := []string{}
+	for key, value := range workReq.GetEnvironment() {
+		env = append(env, fmt.Sprintf("%s=%s", key, value))
+	}
+	cmd.Env = env
+
+	if *logCommands {
+		logger.Println("Executing:", workReq.Arguments)
+	}
+	cmdCtx := ctx
+	if workReq.Timeout > 0 {
+		var cancel context.CancelFunc
+		cmdCtx, cancel = context.WithTimeout(ctx, time.Duration(workReq.Timeout)*time.Second)
+		defer cancel()
+	}
+	err = runCommand(cmdCtx, cmd)
+	<-bh.executionSlots
+	stdout.Close()
+	stderr.Close()
+	bh.storeOutputLogs(logger, workRes, stdout, stderr)
+
+	if ctx.Err() != nil {
+		return workRes, &workError{remote.ErrorCategory_CANCELLED, fmt.Errorf("cancelled during execution")}
+	} else if cmdCtx.Err() != nil {
+		return workRes, &workError{remote.ErrorCategory_TIMEOUT, fmt.Errorf("killed after timeout of %ds", workReq.Timeout)}
+	} else if err != nil {
+		if *logCommands {
+			logger.Println("===================")
+			logger.Println("Execution failed:")
+			logger.Println("STDOUT")
+			logger.Println(workRes.Out)
+			logger.Println("STDERR")
+			logger.Println(workRes.Err)
+			logger.Println("===================")
+		}
+		return workRes, &workError{remote.ErrorCategory_ACTION_FAILED, err}
+	}
+
+	outputActionCache := new(remote.CacheEntry)
+	outputPaths := make(map[string]string)
+
+	for _, outputFile := range workReq.GetOutputFiles() {
+		filePath := filepath.Join(workDir, outputFile.Path)
+		if f, err := os.Open(filePath); err != nil {
+			return workRes, &workError{remote.ErrorCategory_ACTION_FAILED, err}
+		} else {
+			checksum := md5.New()
+			_, err := io.Copy(checksum, f)
+			f.Close()
+			if err != nil {
+				return workRes, &workError{remote.ErrorCategory_ACTION_FAILED, err}
+			}
+			outputFile.ContentKey = hex.EncodeToString(checksum.Sum(nil))
+			outputPaths[outputFile.ContentKey] = filePath
+			outputActionCache.Files = append(outputActionCache.Files, outputFile)
+		}
+	}
+
+	// The cache has no way to tell whether it has an entry short of downloading it, so outputs are always uploaded.
+	for key, filePath := range outputPaths {
+		if err := uploadFile(bh.backingCache, key, filePath); err != nil {
+			logger.Println("Unable to upload output", filePath, err)
+		} else {
+			bh.diskCache.ForgetMissing(key)
+		}
+	}
+
+	writeActionCacheEntry(bh.backingCache, workReq.OutputKey, outputActionCache)
+
+	workRes.Success = true
+	return workRes, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anupcshan/bazel-build-worker/cache"
+	"github.com/anupcshan/bazel-build-worker/remote"
+)
+
+// slowCache is a backing cache that records how many Gets it was serving at most at once. Keys ending in an odd hex
+// digit are missing.
+type slowCache struct {
+	lock    sync.Mutex
+	current int
+	peak    int
+}
+
+func (c *slowCache) Get(key string) ([]byte, error) {
+	c.lock.Lock()
+	c.current++
+	if c.current > c.peak {
+		c.peak = c.current
+	}
+	c.lock.Unlock()
+
+	time.Sleep(time.Millisecond)
+
+	c.lock.Lock()
+	c.current--
+	c.lock.Unlock()
+
+	if strings.IndexByte("13579bdf", key[len(key)-1]) >= 0 {
+		return nil, cache.ErrNotFound
+	}
+	// A serialized CacheEntry with file_content "hello".
+	return []byte("\x12\x05hello"), nil
+}
+
+func (c *slowCache) Put(string, []byte) error { return nil }
+
+func TestFetchInputsParallelism(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	backingCache := new(slowCache)
+	diskCache := cache.NewDiskCache(cacheDir, backingCache)
+	if err := diskCache.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	const numInputs = 3000
+	const parallelism = 16
+	var inputFiles []*remote.FileEntry
+	for i := 0; i < numInputs; i++ {
+		inputFiles = append(inputFiles, &remote.FileEntry{ContentKey: fmt.Sprintf("%032x", i), Executable: i%4 == 0})
+	}
+
+	missing, err := fetchInputs(diskCache, inputFiles, parallelism)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != numInputs/2 {
+		t.Errorf("%d inputs missing, want %d", len(missing), numInputs/2)
+	}
+	for i := 0; i < numInputs; i += 2 {
+		if !diskCache.IsCached(inputFiles[i].ContentKey) {
+			t.Errorf("%s was not cached", inputFiles[i].ContentKey)
+		}
+	}
+
+	if backingCache.peak > parallelism {
+		t.Errorf("%d fetches in flight at once, want at most %d", backingCache.peak, parallelism)
+	} else if backingCache.peak < 2 {
+		t.Errorf("%d fetches in flight at once, want them to run concurrently", backingCache.peak)
+	}
+}
+
+// unavailableCache is a backing cache that fails every request.
+type unavailableCache struct{}
+
+func (unavailableCache) Get(string) ([]byte, error) { return nil, errors.New("cache unavailable") }
+func (unavailableCache) Put(string, []byte) error   { return errors.New("cache unavailable") }
+
+func TestStoreOutputLogsInlinesWhenStoringFails(t *testing.T) {
+	dir, err := ioutil.TempDir("", "execute_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(maxInline, preview int64) {
+		*maxInlineOutput, *outputPreviewBytes = maxInline, preview
+	}(*maxInlineOutput, *outputPreviewBytes)
+	*maxInlineOutput, *outputPreviewBytes = 8, 2
+
+	for _, tc := range []struct {
+		backingCache  cache.Cache
+		out           string
+		wantOut       string
+		wantTruncated bool
+		wantKey       bool
+	}{
+		{new(slowCache), "0123456789", "01", true, true},
+		{new(slowCache), "01234567", "01234567", false, true},
+		{unavailableCache{}, "0123456789", "01234567", true, false},
+		{unavailableCache{}, "01234567", "01234567", false, false},
+	} {
+		bh := &BuildRequestHandler{backingCache: tc.backingCache, diskCache: cache.NewDiskCache(dir, tc.backingCache)}
+		stdout, err := newOutputLog(dir, "stdout")
+		if err != nil {
+			t.Fatal(err)
+		}
+		stderr, err := newOutputLog(dir, "stderr")
+		if err != nil {
+			t.Fatal(err)
+		}
+		stdout.Write([]byte(tc.out))
+
+		workRes := new(remote.RemoteWorkResponse)
+		bh.storeOutputLogs(log.New(ioutil.Discard, "", 0), workRes, stdout, stderr)
+		if workRes.Out != tc.wantOut || workRes.OutTruncated != tc.wantTruncated {
+			t.Errorf("%T, %q: got out %q, truncated %v, want %q, %v", tc.backingCache, tc.out, workRes.Out, workRes.OutTruncated, tc.wantOut, tc.wantTruncated)
+		}
+		if (workRes.StdoutKey != "") != tc.wantKey {
+			t.Errorf("%T, %q: got stdout key %q", tc.backingCache, tc.out, workRes.StdoutKey)
+		}
+		if workRes.Err != "" || workRes.ErrTruncated || workRes.StderrKey != "" {
+			t.Errorf("%T, %q: got stderr %q, truncated %v, key %q for empty stderr", tc.backingCache, tc.out, workRes.Err, workRes.ErrTruncated, workRes.StderrKey)
+		}
+		stdout.Remove()
+		stderr.Remove()
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/anupcshan/bazel-build-worker/cache"
+)
+
+// Key looked up in each cache endpoint to check that it is reachable. Whether it exists does not matter.
+const readinessProbeKey = "readyz-probe"
+
+// healthHandler serves /healthz, which succeeds as long as the worker is serving requests at all, and /readyz,
+// which only succeeds if the worker can currently take on more work.
+type healthHandler struct {
+	cacheEndpoints map[string]*cache.HazelcastCache // By URL
+	probeTimeout   time.Duration
+	diskMonitor    *diskMonitor
+	executionSlots chan struct{}
+	writableDirs   []string
+}
+
+func (hh *healthHandler) serveHealthz(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+func checkWritable(dir string) error {
+	f, err := ioutil.TempFile(dir, ".readyz")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// checks returns the outcome of each readiness check, as "ok" or the reason the check failed.
+func (hh *healthHandler) checks() (map[string]string, bool) {
+	checks := make(map[string]string)
+	ready := true
+	record := func(name string, err error) {
+		if err != nil {
+			checks[name] = err.Error()
+			ready = false
+		} else {
+			checks[name] = "ok"
+		}
+	}
+
+	// Endpoints are probed concurrently and only once each, so the check takes at most probeTimeout.
+	probeErrs := make(map[string]error)
+	var probeLock sync.Mutex
+	var wg sync.WaitGroup
+	for url, endpoint := range hh.cacheEndpoints {
+		wg.Add(1)
+		go func(url string, endpoint *cache.HazelcastCache) {
+			err := endpoint.Ping(readinessProbeKey, hh.probeTimeout)
+			probeLock.Lock()
+			probeErrs[url] = err
+			probeLock.Unlock()
+			wg.Done()
+		}(url, endpoint)
+	}
+	wg.Wait()
+	for url, err := range probeErrs {
+		record("cache "+url, err)
+	}
+	for _, dir := range hh.writableDirs {
+		record("writable "+dir, checkWritable(dir))
+	}
+	if hh.diskMonitor.Critical() {
+		record("disk space", fmt.Errorf("out of disk space"))
+	} else {
+		record("disk space", nil)
+	}
+	if len(hh.executionSlots) >= cap(hh.executionSlots) {
+		record("execution slots", fmt.Errorf("all %d execution slots in use", cap(hh.executionSlots)))
+	} else {
+		record("execution slots", nil)
+	}
+
+	return checks, ready
+}
+
+func (hh *healthHandler) serveReadyz(w http.ResponseWriter, r *http.Request) {
+	checks, ready := hh.checks()
+	status := struct {
+		Ready  bool              `json:"ready"`
+		Checks map[string]string `json:"checks"`
+	}{ready, checks}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
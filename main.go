@@ -1,9 +1,7 @@
 package main
 
 import (
-	"bytes"
-	"crypto/md5"
-	"encoding/hex"
+	"context"
 	_ "expvar"
 	"flag"
 	"fmt"
@@ -12,268 +10,284 @@ import (
 	"net/http"
 	_ "net/http/pprof"
 	"os"
-	"os/exec"
-	"path"
-	"path/filepath"
-	"sync"
+	"runtime"
+	"strings"
 	"time"
 
 	"github.com/anupcshan/bazel-build-worker/cache"
 	"github.com/anupcshan/bazel-build-worker/remote"
-
-	"github.com/golang/protobuf/proto"
 )
 
-func respond(w http.ResponseWriter, workRes *remote.RemoteWorkResponse) {
-	b, err := proto.Marshal(workRes)
+func respond(w http.ResponseWriter, format wireFormat, statusCode int, workRes *remote.RemoteWorkResponse) {
+	b, err := format.marshal(workRes)
 	if err != nil {
 		log.Println(err)
+		w.WriteHeader(statusCode)
 	} else {
+		w.Header().Set("Content-Type", format.contentType())
+		w.WriteHeader(statusCode)
 		w.Write(b)
 	}
 }
 
-func writeError(w http.ResponseWriter, statusCode int, workRes *remote.RemoteWorkResponse, err error) {
-	w.WriteHeader(statusCode)
-	workRes.Exception = err.Error()
-	workRes.Success = false
-	respond(w, workRes)
+func writeError(w http.ResponseWriter, format wireFormat, workRes *remote.RemoteWorkResponse, err error) {
+	respond(w, format, recordError(workRes, err), workRes)
 }
 
-func ensureCached(cacheBaseURL string, file *remote.FileEntry, cacheDir string) error {
-	filePath := filepath.Join(cacheDir, file.ContentKey)
-	if _, err := os.Stat(filePath); err == nil || !os.IsNotExist(err) {
-		return nil
-	}
+type BuildRequestHandler struct {
+	backingCache cache.Cache
+	diskCache    *cache.DiskCache
+	diskMonitor  *diskMonitor
+
+	// Semaphore bounding the number of commands running at once, across all requests.
+	executionSlots chan struct{}
+	// Output of the commands currently running.
+	logs *logRegistry
+}
 
-	dir := path.Dir(filePath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return err
+func readWorkRequest(r *http.Request, format wireFormat) (*remote.RemoteWorkRequest, error) {
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
 	}
 
-	fetchPath := fmt.Sprintf("%s/%s", cacheBaseURL, file.ContentKey)
-	if resp, err := http.Get(fetchPath); err != nil {
-		return err
-	} else {
-		defer resp.Body.Close()
-		perm := os.FileMode(0644)
-		if file.Executable {
-			perm = 0755
-		}
-		if f, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY, perm); err != nil {
-			return err
-		} else {
-			defer f.Close()
-			cacheEntry := new(remote.CacheEntry)
-
-			b, err := ioutil.ReadAll(resp.Body)
-			if err != nil {
-				return err
-			}
-			err = proto.Unmarshal(b, cacheEntry)
-			if err != nil {
-				return err
-			}
-			_, err = f.Write(cacheEntry.FileContent)
-			return err
-		}
+	workReq := new(remote.RemoteWorkRequest)
+	if err := format.unmarshal(b, workReq); err != nil {
+		return nil, &workError{remote.ErrorCategory_INVALID_REQUEST, err}
 	}
-	return nil
+	return workReq, nil
 }
 
-func linkCachedObject(relPath string, workDir string, cachePath string) error {
-	filePath := filepath.Join(workDir, relPath)
-
-	dir := path.Dir(filePath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return err
-	}
-
-	return os.Symlink(cachePath, filePath)
+func requestLogger(workReq *remote.RemoteWorkRequest) *log.Logger {
+	return log.New(os.Stderr, fmt.Sprintf("[%s] ", workReq.OutputKey), log.Lshortfile|log.Lmicroseconds)
 }
 
-func writeCacheEntry(cacheBaseURL string, key string, data []byte) error {
-	cacheEntry := new(remote.CacheEntry)
-	cacheEntry.FileContent = data
-	writePath := fmt.Sprintf("%s/%s", cacheBaseURL, key)
-	b, err := proto.Marshal(cacheEntry)
-	if err != nil {
-		return err
-	}
-	body := bytes.NewBuffer(b)
-	if resp, err := http.Post(writePath, "application/binary", body); err != nil {
-		return err
-	} else {
-		resp.Body.Close()
-	}
-
-	return nil
-}
+const executePath = "/execute"
 
-func writeActionCacheEntry(cacheBaseURL string, key string, cacheEntry *remote.CacheEntry) error {
-	writePath := fmt.Sprintf("%s/%s", cacheBaseURL, key)
-	b, err := proto.Marshal(cacheEntry)
-	if err != nil {
-		return nil
-	}
-	if resp, err := http.Post(writePath, "application/binary", bytes.NewBuffer(b)); err != nil {
-		return err
-	} else {
-		resp.Body.Close()
+// HandleLegacyBuildRequest serves work requests POSTed to "/", where clients sent them before executePath existed.
+func (bh *BuildRequestHandler) HandleLegacyBuildRequest(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
 	}
-
-	return nil
-}
-
-type BuildRequestHandler struct {
-	hazelcastCache cache.Cache
-	diskCache      *cache.DiskCache
+	bh.HandleBuildRequest(w, r)
 }
 
 func (bh *BuildRequestHandler) HandleBuildRequest(w http.ResponseWriter, r *http.Request) {
-	workReq := new(remote.RemoteWorkRequest)
-	workRes := new(remote.RemoteWorkResponse)
-
-	b, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, workRes, err)
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	err = proto.Unmarshal(b, workReq)
+	reqFormat := requestFormat(r.Header.Get("Content-Type"))
+	resFormat := responseFormat(r.Header.Get("Accept"), reqFormat)
+
+	workReq, err := readWorkRequest(r, reqFormat)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, workRes, err)
+		writeError(w, resFormat, new(remote.RemoteWorkResponse), err)
 		return
 	}
 
-	logger := log.New(os.Stderr, fmt.Sprintf("[%s] ", workReq.OutputKey), log.Lshortfile|log.Lmicroseconds)
-
-	workDir, err := ioutil.TempDir(*workdirRoot, "workdir")
+	// Synchronous requests run to completion even if the client goes away, so their outputs still get cached.
+	workRes, err := bh.execute(context.Background(), workReq.OutputKey, requestLogger(workReq), workReq)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, workRes, err)
+		writeError(w, resFormat, workRes, err)
 		return
 	}
 
-	logger.Println("Creating workdir:", workDir)
-	defer func(start time.Time) {
-		os.RemoveAll(workDir)
-		logger.Printf("Completed request in %s", time.Since(start))
-	}(time.Now())
-
-	var wg sync.WaitGroup
-	for _, inputFile := range workReq.GetInputFiles() {
-		wg.Add(1)
-		go func(key string, executable bool) {
-			<-bh.diskCache.EnsureCached(key, executable, 10*time.Minute)
-			wg.Done()
-		}(inputFile.ContentKey, inputFile.Executable)
-	}
+	respond(w, resFormat, http.StatusOK, workRes)
+}
 
-	cacheStart := time.Now()
-	wg.Wait()
-	logger.Printf("Completed caching input files in %s", time.Since(cacheStart))
+func main() {
+	flag.Parse()
 
-	for _, inputFile := range workReq.GetInputFiles() {
-		if err := linkCachedObject(inputFile.Path, workDir, bh.diskCache.GetLink(inputFile.ContentKey)); err != nil {
-			writeError(w, http.StatusInternalServerError, workRes, err)
-			return
-		}
-	}
+	log.SetFlags(log.Lmicroseconds | log.Lshortfile)
 
-	// Most actions expect directories for output files to exist up front.
-	for _, outputFile := range workReq.GetOutputFiles() {
-		filePath := filepath.Join(workDir, outputFile.Path)
+	listenAddr := fmt.Sprintf(":%d", *port)
 
-		dir := path.Dir(filePath)
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			writeError(w, http.StatusInternalServerError, workRes, err)
-			return
-		}
+	hazelcastOptions := cache.HazelcastCacheOptions{
+		RetryPolicy: cache.RetryPolicy{
+			MaxAttempts:    *cacheMaxAttempts,
+			InitialBackoff: *cacheInitialBackoff,
+			MaxBackoff:     *cacheMaxBackoff,
+			Multiplier:     cache.DefaultRetryPolicy.Multiplier,
+		},
+		BreakerThreshold: *cacheBreakerThreshold,
+		BreakerCooldown:  *cacheBreakerCooldown,
+
+		MaxInFlight:           *cacheMaxInFlight,
+		MaxIdleConnsPerHost:   *cacheMaxInFlight,
+		ResponseHeaderTimeout: cache.DefaultHazelcastCacheOptions.ResponseHeaderTimeout,
 	}
 
-	cmd := exec.Command(workReq.Arguments[0], workReq.Arguments[1:]...)
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	cmd.Dir = workDir
+	var backingCache cache.Cache
+	cacheEndpoints := make(map[string]*cache.HazelcastCache)
+	if cacheURLs := strings.Split(*cacheBaseURL, ","); len(cacheURLs) == 1 {
+		cacheEndpoints[cacheURLs[0]] = cache.NewHazelcastCache(cacheURLs[0], hazelcastOptions)
+		backingCache = cacheEndpoints[cacheURLs[0]]
+	} else {
+		shards := make(map[string]cache.Cache)
+		for _, cacheURL := range cacheURLs {
+			cacheEndpoints[cacheURL] = cache.NewHazelcastCache(cacheURL, hazelcastOptions)
+			shards[cacheURL] = cacheEndpoints[cacheURL]
+		}
+		backingCache = cache.NewShardedCache(shards, *cacheVirtualNodes, *cacheReplicas)
+	}
 
-	env := []string{}
-	for key, value := range workReq.GetEnvironment() {
-		env = append(env, fmt.Sprintf("%s=%s", key, value))
+	if *cacheKeyring != "" {
+		keyring, err := cache.LoadKeyring(*cacheKeyring)
+		if err != nil {
+			log.Fatal(err)
+		}
+		backingCache = cache.NewEncryptingCache(backingCache, keyring, *cacheAllowPlaintext)
 	}
-	cmd.Env = env
 
-	if *logCommands {
-		logger.Println("Executing:", workReq.Arguments)
+	// Entries are compressed before they are encrypted, since ciphertext does not compress.
+	switch *cacheCompression {
+	case "none":
+	case "gzip":
+		backingCache = cache.NewCompressingCache(backingCache, *cacheCompressionThreshold)
+	default:
+		log.Fatalf("Unsupported --cache-compression %q", *cacheCompression)
 	}
-	err = cmd.Run()
-	if err != nil {
-		if *logCommands {
-			logger.Println("===================")
-			logger.Println("Execution failed:")
-			logger.Println("STDOUT")
-			logger.Println(stdout.String())
-			logger.Println("STDERR")
-			logger.Println(stderr.String())
-			logger.Println("===================")
+
+	diskCache := cache.NewDiskCache(*cacheDir, backingCache)
+	if *fsckCacheDir {
+		problems, err := diskCache.Fsck()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+		if len(problems) > 0 {
+			os.Exit(1)
 		}
-		workRes.Out = stdout.String()
-		workRes.Err = stderr.String()
-		writeError(w, http.StatusOK, workRes, err)
 		return
 	}
+	if err := os.MkdirAll(*cacheDir, 0755); err != nil {
+		log.Fatal(err)
+	}
+	if err := diskCache.Load(); err != nil {
+		log.Fatal(err)
+	}
+	diskCache.SetNegativeTTL(*negativeCacheTTL)
+	if *peers != "" {
+		diskCache.SetPeers(cache.NewPeerSet(strings.Split(*peers, ","), *peerProbeTimeout))
+	}
 
-	workRes.Out = stdout.String()
-	workRes.Err = stderr.String()
-
-	outputActionCache := new(remote.CacheEntry)
-
-	for _, outputFile := range workReq.GetOutputFiles() {
-		filePath := filepath.Join(workDir, outputFile.Path)
-		if f, err := os.Open(filePath); err != nil {
-			writeError(w, http.StatusOK, workRes, err)
-			return
-		} else if b, err := ioutil.ReadAll(f); err != nil {
-			writeError(w, http.StatusOK, workRes, err)
-			return
-		} else {
-			checksum := md5.Sum(b)
-			writeCacheEntry(*cacheBaseURL, hex.EncodeToString(checksum[:md5.Size]), b)
-			outputFile.ContentKey = hex.EncodeToString(checksum[:md5.Size])
-			outputActionCache.Files = append(outputActionCache.Files, outputFile)
+	prewarm := &prewarmHandler{diskCache: diskCache, concurrency: *prewarmConcurrency}
+	if *prewarmManifest != "" {
+		if err := prewarm.prewarmFromFile(*prewarmManifest); err != nil {
+			log.Fatal(err)
 		}
 	}
 
-	writeActionCacheEntry(*cacheBaseURL, workReq.OutputKey, outputActionCache)
-
-	workRes.Success = true
-	w.WriteHeader(http.StatusOK)
-	respond(w, workRes)
-}
-
-func main() {
-	flag.Parse()
-
-	log.SetFlags(log.Lmicroseconds | log.Lshortfile)
-
-	listenAddr := fmt.Sprintf(":%d", *port)
+	if *useCountsSaveInterval > 0 {
+		go diskCache.SaveUseCounts(*useCountsSaveInterval)
+	}
+	if *scrubRate > 0 {
+		go diskCache.Scrub(*scrubRate, *scrubInterval)
+	}
 
-	hc := cache.NewHazelcastCache(*cacheBaseURL)
-	diskCache := cache.NewDiskCache(*cacheDir, hc)
+	monitor := &diskMonitor{
+		workdirRoot:       *workdirRoot,
+		cacheDir:          *cacheDir,
+		diskCache:         diskCache,
+		highWatermark:     *diskHighWatermark,
+		lowWatermark:      *diskLowWatermark,
+		criticalWatermark: *diskCriticalWatermark,
+	}
+	monitor.check()
+	go monitor.run(*diskCheckInterval)
+
+	buildRequestHandler := &BuildRequestHandler{
+		backingCache:   backingCache,
+		diskCache:      diskCache,
+		diskMonitor:    monitor,
+		executionSlots: make(chan struct{}, *maxConcurrentActions),
+		logs:           newLogRegistry(),
+	}
 
-	buildRequestHandler := &BuildRequestHandler{hazelcastCache: hc, diskCache: diskCache}
+	health := &healthHandler{
+		cacheEndpoints: cacheEndpoints,
+		probeTimeout:   *readyzCacheTimeout,
+		diskMonitor:    monitor,
+		executionSlots: buildRequestHandler.executionSlots,
+		writableDirs:   []string{*cacheDir, *workdirRoot},
+	}
 
-	http.HandleFunc("/", buildRequestHandler.HandleBuildRequest)
+	mux := http.NewServeMux()
+	mux.HandleFunc(executePath, buildRequestHandler.HandleBuildRequest)
+	mux.HandleFunc("/", buildRequestHandler.HandleLegacyBuildRequest)
+	mux.HandleFunc(capabilitiesPath, buildRequestHandler.HandleCapabilities)
+	mux.HandleFunc(batchPath, buildRequestHandler.HandleBatchRequest)
+	mux.Handle(logsPrefix, buildRequestHandler.logs)
+	mux.Handle(operationsPrefix, newOperationTable(buildRequestHandler, *operationRetention, *maxActiveOperations))
+	// Peers are not authenticated, and cached files are stored decrypted, so they are only shared if the cache is not
+	// encrypted.
+	if *cacheKeyring == "" {
+		mux.Handle(cache.PeerPathPrefix, diskCache)
+	} else {
+		log.Printf("Not serving cached files to peers under %s since --cache-keyring is set", cache.PeerPathPrefix)
+	}
+	mux.Handle("/statusz", monitor)
+	mux.Handle("/admin/prewarm", prewarm)
+	mux.HandleFunc("/healthz", health.serveHealthz)
+	mux.HandleFunc("/readyz", health.serveReadyz)
+	// pprof and expvar register themselves on the default mux.
+	mux.Handle("/debug/", http.DefaultServeMux)
+
+	if *serveCacheDir != "" {
+		restServer, err := cache.NewRESTServer(*serveCacheDir, *serveCacheMaxBytes)
+		if err != nil {
+			log.Fatal(err)
+		}
+		mux.Handle(cache.RESTServerPrefix, restServer)
+	}
 
-	err := http.ListenAndServe(listenAddr, nil)
+	err := http.ListenAndServe(listenAddr, mux)
 	log.Fatal(err)
 }
 
 var (
-	port         = flag.Int("port", 1234, "Port to listen on")
-	cacheBaseURL = flag.String("cache-base-url", "http://localhost:5701/hazelcast/rest/maps/hazelcast-build-cache", "Base of cache URL to connect to")
-	workdirRoot  = flag.String("workdir-root", "/tmp/", "Directory to create working subdirectories to execute actions in")
-	cacheDir     = flag.String("cachedir", "/tmp/bazel-worker-cache", "Directory to store cached objects")
-	logCommands  = flag.Bool("log-commands", true, "Log all command executions (include stdout/stderr in case of failures)")
+	port                      = flag.Int("port", 1234, "Port to listen on")
+	cacheBaseURL              = flag.String("cache-base-url", "http://localhost:5701/hazelcast/rest/maps/hazelcast-build-cache", "Base of cache URL to connect to. Multiple comma-separated URLs shard keys across all of them")
+	cacheReplicas             = flag.Int("cache-replicas", 1, "Number of shards each cache entry is written to when multiple cache URLs are given")
+	cacheVirtualNodes         = flag.Int("cache-virtual-nodes", 100, "Number of points each cache shard gets on the consistent hash ring")
+	cacheMaxAttempts          = flag.Int("cache-max-attempts", cache.DefaultRetryPolicy.MaxAttempts, "Number of times a cache request is attempted before giving up")
+	cacheInitialBackoff       = flag.Duration("cache-initial-backoff", cache.DefaultRetryPolicy.InitialBackoff, "Delay before the first cache request retry, doubled on every further retry")
+	cacheMaxBackoff           = flag.Duration("cache-max-backoff", cache.DefaultRetryPolicy.MaxBackoff, "Maximum delay between cache request retries")
+	cacheBreakerThreshold     = flag.Int("cache-breaker-threshold", cache.DefaultHazelcastCacheOptions.BreakerThreshold, "Consecutive failures after which a cache endpoint is failed fast (0 to disable)")
+	cacheBreakerCooldown      = flag.Duration("cache-breaker-cooldown", cache.DefaultHazelcastCacheOptions.BreakerCooldown, "How long a failing cache endpoint is failed fast before it is probed again")
+	cacheMaxInFlight          = flag.Int("cache-max-in-flight", cache.DefaultHazelcastCacheOptions.MaxInFlight, "Maximum number of concurrent requests to each cache endpoint")
+	cacheCompression          = flag.String("cache-compression", "none", "Compression applied to new cache entries: none or gzip. Existing entries are readable either way")
+	cacheCompressionThreshold = flag.Int("cache-compression-threshold", 1024, "Entries smaller than this many bytes are stored uncompressed")
+	cacheKeyring              = flag.String("cache-keyring", "", "File with \"<key ID> <hex AES key>\" lines to encrypt cache entries with. The last key is used for new entries")
+	cacheAllowPlaintext       = flag.Bool("cache-allow-plaintext", false, "With --cache-keyring, still accept cache entries that were stored unencrypted")
+	maxConcurrentActions      = flag.Int("max-concurrent-actions", runtime.NumCPU(), "Maximum number of action commands running at once; further actions wait for a slot")
+	operationRetention        = flag.Duration("operation-retention", 10*time.Minute, "How long results of asynchronous operations can be polled for after they complete")
+	maxActiveOperations       = flag.Int("max-active-operations", 64, "Maximum number of asynchronous operations queued or running at once; further submissions are rejected as overloaded")
+	maxInlineOutput           = flag.Int64("max-inline-output", 1<<20, "Largest stdout or stderr returned inline in responses. Larger outputs are only available from the cache")
+	outputPreviewBytes        = flag.Int64("output-preview-bytes", 16<<10, "How much of the beginning of a stdout or stderr beyond --max-inline-output is returned inline")
+	maxFetchesPerRequest      = flag.Int("max-fetches-per-request", 32, "Maximum number of input files fetched concurrently for a single request")
+	serveCacheDir             = flag.String("serve-cache-dir", "", "If set, also serve a Hazelcast-compatible REST cache under /hazelcast/rest/maps/, stored in this directory")
+	serveCacheMaxBytes        = flag.Int64("serve-cache-max-bytes", 10<<30, "Size budget of --serve-cache-dir. Least recently used entries are evicted beyond it")
+	negativeCacheTTL          = flag.Duration("negative-cache-ttl", 10*time.Second, "How long to remember that an input was missing from the cache before asking again (0 to disable)")
+	peers                     = flag.String("peers", "", "Comma-separated base URLs of other workers (e.g. http://worker2:1234) to fetch cached inputs from before going to the cache")
+	peerProbeTimeout          = flag.Duration("peer-probe-timeout", 200*time.Millisecond, "How long to wait for peers to answer whether they have an input")
+	workdirRoot               = flag.String("workdir-root", "/tmp/", "Directory to create working subdirectories to execute actions in")
+	cacheDir                  = flag.String("cachedir", "/tmp/bazel-worker-cache", "Directory to store cached objects")
+	diskHighWatermark         = flag.Float64("disk-high-watermark", 0.90, "Fraction of the --cachedir file system in use above which cache entries are evicted")
+	diskLowWatermark          = flag.Float64("disk-low-watermark", 0.80, "Fraction of the --cachedir file system in use that eviction brings usage down to")
+	diskCriticalWatermark     = flag.Float64("disk-critical-watermark", 0.97, "Fraction of the --cachedir or --workdir-root file system in use above which new requests are rejected")
+	diskCheckInterval         = flag.Duration("disk-check-interval", 10*time.Second, "How often to check free disk space")
+	scrubRate                 = flag.Int64("scrub-rate", 4<<20, "Bytes per second the background scrubber may read from --cachedir to verify entries (0 to disable)")
+	scrubInterval             = flag.Duration("scrub-interval", time.Hour, "Pause between full passes of the background scrubber")
+	prewarmManifest           = flag.String("prewarm-manifest", "", "File listing \"<content key> [x]\" lines to fetch into --cachedir in the background at startup")
+	prewarmConcurrency        = flag.Int("prewarm-concurrency", 8, "Maximum number of concurrent fetches while prewarming")
+	readyzCacheTimeout        = flag.Duration("readyz-cache-timeout", time.Second, "How long /readyz waits for each cache endpoint to answer before reporting the worker not ready")
+	useCountsSaveInterval     = flag.Duration("use-counts-save-interval", 5*time.Minute, "How often to save input use counts to --cachedir, so /admin/prewarm still knows the hottest inputs after a restart (0 to disable)")
+	fsckCacheDir              = flag.Bool("fsck-cachedir", false, "Check that --cachedir follows the expected layout, print any problems and exit")
+	logCommands               = flag.Bool("log-commands", true, "Log all command executions (include stdout/stderr in case of failures)")
 )
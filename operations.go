@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anupcshan/bazel-build-worker/remote"
+)
+
+const operationsPrefix = "/operations/"
+
+// operation is a work request executing in the background.
+type operation struct {
+	name   string
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// Only valid once done is closed.
+	workRes *remote.RemoteWorkResponse
+	status  int
+}
+
+func (op *operation) proto() *remote.Operation {
+	select {
+	case <-op.done:
+		return &remote.Operation{Name: op.name, Done: true, Response: op.workRes, StatusCode: int32(op.status)}
+	default:
+		return &remote.Operation{Name: op.name}
+	}
+}
+
+// operationTable runs work requests asynchronously, so clients do not have to hold a connection open for as long as
+// an action runs. Under operationsPrefix it serves:
+//
+//	POST /operations/              Submit a RemoteWorkRequest, answered with 202 and an Operation
+//	GET  /operations/<name>        Current Operation; ?wait=<duration> blocks until it is done or the duration passed
+//	POST /operations/<name>/cancel Kill the action; the Operation then completes with status 499
+//
+// Completed operations are forgotten after the retention period. Operations stage their workdir as soon as they are
+// submitted, so at most maxActive may be queued or running at once; submissions beyond that are rejected as
+// OVERLOADED.
+type operationTable struct {
+	bh        *BuildRequestHandler
+	retention time.Duration
+	maxActive int
+
+	lock       sync.Mutex
+	operations map[string]*operation
+	active     int
+}
+
+func newOperationTable(bh *BuildRequestHandler, retention time.Duration, maxActive int) *operationTable {
+	return &operationTable{
+		bh:         bh,
+		retention:  retention,
+		maxActive:  maxActive,
+		operations: make(map[string]*operation),
+	}
+}
+
+func newOperationName() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (ot *operationTable) submit(workReq *remote.RemoteWorkRequest) (*operation, error) {
+	name, err := newOperationName()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	op := &operation{name: name, cancel: cancel, done: make(chan struct{})}
+
+	ot.lock.Lock()
+	if ot.active >= ot.maxActive {
+		ot.lock.Unlock()
+		cancel()
+		return nil, &workError{remote.ErrorCategory_OVERLOADED, fmt.Errorf("too many operations queued or running (limit %d)", ot.maxActive)}
+	}
+	ot.active++
+	ot.operations[name] = op
+	ot.lock.Unlock()
+
+	go func() {
+		logger := log.New(os.Stderr, fmt.Sprintf("[%s %s] ", workReq.OutputKey, name), log.Lshortfile|log.Lmicroseconds)
+		workRes, err := ot.bh.execute(ctx, name, logger, workReq)
+		cancel()
+
+		op.workRes, op.status = workRes, recordError(workRes, err)
+		close(op.done)
+
+		ot.lock.Lock()
+		ot.active--
+		ot.lock.Unlock()
+
+		time.AfterFunc(ot.retention, func() {
+			ot.lock.Lock()
+			delete(ot.operations, name)
+			ot.lock.Unlock()
+		})
+	}()
+
+	return op, nil
+}
+
+func (ot *operationTable) get(name string) *operation {
+	ot.lock.Lock()
+	defer ot.lock.Unlock()
+
+	return ot.operations[name]
+}
+
+func (ot *operationTable) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reqFormat := requestFormat(r.Header.Get("Content-Type"))
+	resFormat := responseFormat(r.Header.Get("Accept"), reqFormat)
+
+	path := strings.TrimPrefix(r.URL.Path, operationsPrefix)
+	if path == "" {
+		if r.Method != "POST" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		workReq, err := readWorkRequest(r, reqFormat)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		op, err := ot.submit(workReq)
+		if err != nil {
+			writeError(w, resFormat, new(remote.RemoteWorkResponse), err)
+			return
+		}
+
+		w.Header().Set("Location", operationsPrefix+op.name)
+		ot.respond(w, resFormat, http.StatusAccepted, op)
+		return
+	}
+
+	name := strings.TrimSuffix(path, "/cancel")
+	op := ot.get(name)
+	if op == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case name != path && r.Method == "POST":
+		// The action is killed in the background; poll to see it complete.
+		op.cancel()
+	case name == path && r.Method == "GET":
+		if wait := r.URL.Query().Get("wait"); wait != "" {
+			d, err := time.ParseDuration(wait)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid wait: %s", err), http.StatusBadRequest)
+				return
+			}
+			select {
+			case <-op.done:
+			case <-time.After(d):
+			case <-r.Context().Done():
+				return
+			}
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ot.respond(w, resFormat, http.StatusOK, op)
+}
+
+func (ot *operationTable) respond(w http.ResponseWriter, format wireFormat, statusCode int, op *operation) {
+	b, err := format.marshal(op.proto())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", format.contentType())
+	w.WriteHeader(statusCode)
+	w.Write(b)
+}
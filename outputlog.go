@@ -0,0 +1,265 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+const logsPrefix = "/logs/"
+
+// outputLog collects the stdout or stderr of a command in a file, so large outputs do not have to be kept in memory,
+// and lets readers tail it while the command is still writing.
+type outputLog struct {
+	f *os.File
+
+	lock   sync.Mutex
+	cond   *sync.Cond
+	size   int64
+	closed bool
+}
+
+func newOutputLog(dir string, prefix string) (*outputLog, error) {
+	f, err := ioutil.TempFile(dir, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &outputLog{f: f}
+	l.cond = sync.NewCond(&l.lock)
+	return l, nil
+}
+
+func (l *outputLog) Write(p []byte) (int, error) {
+	n, err := l.f.Write(p)
+
+	l.lock.Lock()
+	l.size += int64(n)
+	l.cond.Broadcast()
+	l.lock.Unlock()
+
+	return n, err
+}
+
+// Close marks the log as complete. Readers then get EOF once they have read everything written.
+func (l *outputLog) Close() error {
+	l.lock.Lock()
+	l.closed = true
+	l.cond.Broadcast()
+	l.lock.Unlock()
+
+	return nil
+}
+
+// Remove closes the log if that has not happened yet, so readers tailing it do not wait forever, and deletes the
+// log file. Readers can keep reading what was written.
+func (l *outputLog) Remove() error {
+	l.Close()
+	l.f.Close()
+	return os.Remove(l.f.Name())
+}
+
+func (l *outputLog) Size() int64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.size
+}
+
+func isDone(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
+
+// waitFor blocks until the log is longer than offset or closed, or done is closed, and returns how much of the log
+// can be read.
+func (l *outputLog) waitFor(offset int64, done <-chan struct{}) (size int64, closed bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.size <= offset && !l.closed {
+		// The condition variable cannot wait for done itself, so wake it when done is closed.
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			select {
+			case <-done:
+				l.lock.Lock()
+				l.cond.Broadcast()
+				l.lock.Unlock()
+			case <-stop:
+			}
+		}()
+	}
+
+	for l.size <= offset && !l.closed && !isDone(done) {
+		l.cond.Wait()
+	}
+	return l.size, l.closed
+}
+
+// NewReader returns a reader over the whole log that blocks at the end until more is written or the log is closed.
+// Once done is closed, reads at the end fail with errReaderDone instead of blocking.
+func (l *outputLog) NewReader(done <-chan struct{}) (io.ReadCloser, error) {
+	f, err := os.Open(l.f.Name())
+	if err != nil {
+		return nil, err
+	}
+	return &outputLogReader{log: l, f: f, done: done}, nil
+}
+
+// Head returns up to the first n bytes written to the log.
+func (l *outputLog) Head(n int64) string {
+	if size := l.Size(); n > size {
+		n = size
+	}
+	b, _ := ioutil.ReadAll(io.NewSectionReader(l.f, 0, n))
+	return string(b)
+}
+
+// Inline returns the log for inclusion in a response: all of it if it is at most maxInline bytes long, otherwise
+// the first previewBytes and true.
+func (l *outputLog) Inline(maxInline int64, previewBytes int64) (string, bool) {
+	if l.Size() <= maxInline {
+		return l.Head(maxInline), false
+	}
+	return l.Head(previewBytes), true
+}
+
+// Key returns the content key of the log, or "" if it is empty.
+func (l *outputLog) Key() (string, error) {
+	size := l.Size()
+	if size == 0 {
+		return "", nil
+	}
+
+	checksum := md5.New()
+	if _, err := io.Copy(checksum, io.NewSectionReader(l.f, 0, size)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(checksum.Sum(nil)), nil
+}
+
+var errReaderDone = errors.New("stopped following output log")
+
+type outputLogReader struct {
+	log    *outputLog
+	f      *os.File
+	done   <-chan struct{}
+	offset int64
+}
+
+func (r *outputLogReader) Read(p []byte) (int, error) {
+	size, closed := r.log.waitFor(r.offset, r.done)
+	if r.offset >= size && closed {
+		return 0, io.EOF
+	} else if r.offset >= size {
+		return 0, errReaderDone
+	}
+
+	if remaining := size - r.offset; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := r.f.ReadAt(p, r.offset)
+	r.offset += int64(n)
+	if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (r *outputLogReader) Close() error {
+	return r.f.Close()
+}
+
+// logRegistry tracks the output logs of running actions, so they can be followed under logsPrefix:
+//
+//	GET /logs/<id>/stdout
+//	GET /logs/<id>/stderr
+//
+// where <id> is the operation name for asynchronous requests and the output key for synchronous ones. The response
+// streams the output so far and then follows it until the action finishes.
+type logRegistry struct {
+	lock sync.Mutex
+	logs map[string]map[string]*outputLog
+}
+
+func newLogRegistry() *logRegistry {
+	return &logRegistry{logs: make(map[string]map[string]*outputLog)}
+}
+
+func (lr *logRegistry) register(id string, stdout *outputLog, stderr *outputLog) {
+	lr.lock.Lock()
+	defer lr.lock.Unlock()
+
+	lr.logs[id] = map[string]*outputLog{"stdout": stdout, "stderr": stderr}
+}
+
+// unregister removes the logs of id, unless another action with the same id has registered its logs since.
+func (lr *logRegistry) unregister(id string, stdout *outputLog) {
+	lr.lock.Lock()
+	defer lr.lock.Unlock()
+
+	if lr.logs[id]["stdout"] == stdout {
+		delete(lr.logs, id)
+	}
+}
+
+func (lr *logRegistry) get(id string, stream string) *outputLog {
+	lr.lock.Lock()
+	defer lr.lock.Unlock()
+
+	return lr.logs[id][stream]
+}
+
+func (lr *logRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, logsPrefix)
+	i := strings.LastIndex(path, "/")
+	if i < 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	l := lr.get(path[:i], path[i+1:])
+	if l == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Stop following the log once the client goes away, even if the action is not writing anything.
+	rc, err := l.NewReader(r.Context().Done())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rc.Close()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := rc.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
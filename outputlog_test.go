@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRemoveWakesTailingReaders(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outputlog_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := newOutputLog(dir, "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Write([]byte("partial"))
+
+	rc, err := l.NewReader(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	done := make(chan string)
+	go func() {
+		b, _ := ioutil.ReadAll(rc)
+		done <- string(b)
+	}()
+
+	// An action cancelled before it got to run removes its logs without closing them first.
+	l.Remove()
+	select {
+	case got := <-done:
+		if got != "partial" {
+			t.Errorf("read %q, want %q", got, "partial")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reader still blocked after Remove")
+	}
+}
+
+func TestReaderStopsWhenDone(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outputlog_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := newOutputLog(dir, "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Remove()
+	l.Write([]byte("partial"))
+
+	done := make(chan struct{})
+	rc, err := l.NewReader(done)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	result := make(chan error)
+	go func() {
+		_, err := ioutil.ReadAll(rc)
+		result <- err
+	}()
+
+	// As if the client following the log disconnected while the action is silent.
+	close(done)
+	select {
+	case err := <-result:
+		if err != errReaderDone {
+			t.Errorf("read error = %v, want %v", err, errReaderDone)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reader still blocked after done was closed")
+	}
+}
@@ -13,6 +13,10 @@ It has these top-level messages:
 	FileEntry
 	RemoteWorkRequest
 	RemoteWorkResponse
+	Operation
+	RemoteWorkBatchRequest
+	RemoteWorkBatchResponse
+	WorkerCapabilities
 */
 package remote
 
@@ -29,6 +33,55 @@ var _ = math.Inf
 // is compatible with the proto package it is being compiled against.
 const _ = proto.ProtoPackageIsVersion1
 
+// Why a work request did not succeed, so clients can tell failures of the
+// command itself from failures of the worker.
+type ErrorCategory int32
+
+const (
+	ErrorCategory_NO_ERROR ErrorCategory = 0
+	// The command ran and failed, or did not produce its outputs.
+	ErrorCategory_ACTION_FAILED ErrorCategory = 1
+	// Input files are missing from the cache and need to be uploaded.
+	ErrorCategory_MISSING_INPUT ErrorCategory = 2
+	// The worker could not stage inputs, run the command or store outputs.
+	ErrorCategory_INFRASTRUCTURE ErrorCategory = 3
+	// The command ran longer than RemoteWorkRequest.timeout.
+	ErrorCategory_TIMEOUT ErrorCategory = 4
+	// The worker is not accepting work right now, e.g. for lack of disk space.
+	ErrorCategory_OVERLOADED ErrorCategory = 5
+	// The request is malformed or asks for something the worker does not
+	// support.
+	ErrorCategory_INVALID_REQUEST ErrorCategory = 6
+	// The client cancelled the request.
+	ErrorCategory_CANCELLED ErrorCategory = 7
+)
+
+var ErrorCategory_name = map[int32]string{
+	0: "NO_ERROR",
+	1: "ACTION_FAILED",
+	2: "MISSING_INPUT",
+	3: "INFRASTRUCTURE",
+	4: "TIMEOUT",
+	5: "OVERLOADED",
+	6: "INVALID_REQUEST",
+	7: "CANCELLED",
+}
+var ErrorCategory_value = map[string]int32{
+	"NO_ERROR":        0,
+	"ACTION_FAILED":   1,
+	"MISSING_INPUT":   2,
+	"INFRASTRUCTURE":  3,
+	"TIMEOUT":         4,
+	"OVERLOADED":      5,
+	"INVALID_REQUEST": 6,
+	"CANCELLED":       7,
+}
+
+func (x ErrorCategory) String() string {
+	return proto.EnumName(ErrorCategory_name, int32(x))
+}
+func (ErrorCategory) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
 // A message for cache entry.
 type CacheEntry struct {
 	// A list of files stored in this cache entry.
@@ -87,6 +140,11 @@ type RemoteWorkRequest struct {
 	OutputFiles []*FileEntry `protobuf:"bytes,5,rep,name=output_files,json=outputFiles" json:"output_files,omitempty"`
 	// Timeout for running this command.
 	Timeout int32 `protobuf:"varint,6,opt,name=timeout" json:"timeout,omitempty"`
+	// Digest function the content keys were computed with. Empty means MD5.
+	DigestFunction string `protobuf:"bytes,7,opt,name=digest_function,json=digestFunction" json:"digest_function,omitempty"`
+	// Platform properties the worker must have to run this command, as
+	// reported in WorkerCapabilities.platform.
+	Platform map[string]string `protobuf:"bytes,8,rep,name=platform" json:"platform,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
 }
 
 func (m *RemoteWorkRequest) Reset()                    { *m = RemoteWorkRequest{} }
@@ -115,6 +173,13 @@ func (m *RemoteWorkRequest) GetOutputFiles() []*FileEntry {
 	return nil
 }
 
+func (m *RemoteWorkRequest) GetPlatform() map[string]string {
+	if m != nil {
+		return m.Platform
+	}
+	return nil
+}
+
 // A message for a work response.
 type RemoteWorkResponse struct {
 	// True if the work was successful.
@@ -125,6 +190,24 @@ type RemoteWorkResponse struct {
 	Err string `protobuf:"bytes,3,opt,name=err" json:"err,omitempty"`
 	// String for the exception when running this work.
 	Exception string `protobuf:"bytes,4,opt,name=exception" json:"exception,omitempty"`
+	// Content keys of input files that could not be found in the cache.
+	MissingInputKeys []string `protobuf:"bytes,5,rep,name=missing_input_keys,json=missingInputKeys" json:"missing_input_keys,omitempty"`
+	// True if the same request may succeed when sent again, e.g. once the
+	// missing input files have been uploaded.
+	Retryable bool `protobuf:"varint,6,opt,name=retryable" json:"retryable,omitempty"`
+	// Content keys under which the complete stdout and stderr of the work are
+	// stored in the cache, if they were not empty.
+	StdoutKey string `protobuf:"bytes,7,opt,name=stdout_key,json=stdoutKey" json:"stdout_key,omitempty"`
+	StderrKey string `protobuf:"bytes,8,opt,name=stderr_key,json=stderrKey" json:"stderr_key,omitempty"`
+	// True if out or err only hold the beginning of an output too large to
+	// inline. The complete output can be fetched from the cache under
+	// stdout_key or stderr_key, unless storing it failed and the key is not
+	// set.
+	OutTruncated bool `protobuf:"varint,9,opt,name=out_truncated,json=outTruncated" json:"out_truncated,omitempty"`
+	ErrTruncated bool `protobuf:"varint,10,opt,name=err_truncated,json=errTruncated" json:"err_truncated,omitempty"`
+	// Why the work did not succeed. retryable is set for the categories where
+	// sending the same request again may help.
+	ErrorCategory ErrorCategory `protobuf:"varint,11,opt,name=error_category,json=errorCategory,enum=build.remote.ErrorCategory" json:"error_category,omitempty"`
 }
 
 func (m *RemoteWorkResponse) Reset()                    { *m = RemoteWorkResponse{} }
@@ -132,40 +215,182 @@ func (m *RemoteWorkResponse) String() string            { return proto.CompactTe
 func (*RemoteWorkResponse) ProtoMessage()               {}
 func (*RemoteWorkResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
 
+// Status of a work request submitted for asynchronous execution.
+type Operation struct {
+	// Identifier to poll for or cancel the operation with.
+	Name string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	// True once the work has finished, failed or been cancelled.
+	Done bool `protobuf:"varint,2,opt,name=done" json:"done,omitempty"`
+	// Result of the work, set once done.
+	Response *RemoteWorkResponse `protobuf:"bytes,3,opt,name=response" json:"response,omitempty"`
+	// HTTP status a synchronous request would have been answered with, set
+	// once done.
+	StatusCode int32 `protobuf:"varint,4,opt,name=status_code,json=statusCode" json:"status_code,omitempty"`
+}
+
+func (m *Operation) Reset()                    { *m = Operation{} }
+func (m *Operation) String() string            { return proto.CompactTextString(m) }
+func (*Operation) ProtoMessage()               {}
+func (*Operation) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+func (m *Operation) GetResponse() *RemoteWorkResponse {
+	if m != nil {
+		return m.Response
+	}
+	return nil
+}
+
+// Several work requests sent together, to save a round trip per request.
+type RemoteWorkBatchRequest struct {
+	Requests []*RemoteWorkRequest `protobuf:"bytes,1,rep,name=requests" json:"requests,omitempty"`
+}
+
+func (m *RemoteWorkBatchRequest) Reset()                    { *m = RemoteWorkBatchRequest{} }
+func (m *RemoteWorkBatchRequest) String() string            { return proto.CompactTextString(m) }
+func (*RemoteWorkBatchRequest) ProtoMessage()               {}
+func (*RemoteWorkBatchRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+func (m *RemoteWorkBatchRequest) GetRequests() []*RemoteWorkRequest {
+	if m != nil {
+		return m.Requests
+	}
+	return nil
+}
+
+// Result of one request of a RemoteWorkBatchRequest. Results are sent as
+// each request completes, so they are not necessarily in request order.
+type RemoteWorkBatchResponse struct {
+	// Position of the request in RemoteWorkBatchRequest.requests.
+	Index int32 `protobuf:"varint,1,opt,name=index" json:"index,omitempty"`
+	// Result of the request.
+	Response *RemoteWorkResponse `protobuf:"bytes,2,opt,name=response" json:"response,omitempty"`
+	// HTTP status the request would have been answered with on its own.
+	StatusCode int32 `protobuf:"varint,3,opt,name=status_code,json=statusCode" json:"status_code,omitempty"`
+}
+
+func (m *RemoteWorkBatchResponse) Reset()                    { *m = RemoteWorkBatchResponse{} }
+func (m *RemoteWorkBatchResponse) String() string            { return proto.CompactTextString(m) }
+func (*RemoteWorkBatchResponse) ProtoMessage()               {}
+func (*RemoteWorkBatchResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+func (m *RemoteWorkBatchResponse) GetResponse() *RemoteWorkResponse {
+	if m != nil {
+		return m.Response
+	}
+	return nil
+}
+
+// Features and limits of a worker, for clients to check before sending
+// requests.
+type WorkerCapabilities struct {
+	// Version of the worker protocol, bumped on incompatible changes.
+	ProtocolVersion int32 `protobuf:"varint,1,opt,name=protocol_version,json=protocolVersion" json:"protocol_version,omitempty"`
+	// Digest functions accepted in RemoteWorkRequest.digest_function.
+	DigestFunctions []string `protobuf:"bytes,2,rep,name=digest_functions,json=digestFunctions" json:"digest_functions,omitempty"`
+	// Compression applied to entries the worker writes to the cache.
+	CacheCompression string `protobuf:"bytes,3,opt,name=cache_compression,json=cacheCompression" json:"cache_compression,omitempty"`
+	// Largest stdout or stderr returned inline in a RemoteWorkResponse.
+	MaxInlineOutput int64 `protobuf:"varint,4,opt,name=max_inline_output,json=maxInlineOutput" json:"max_inline_output,omitempty"`
+	// Number of commands the worker runs at once, and how many more it could
+	// start right now.
+	MaxConcurrentActions int32 `protobuf:"varint,5,opt,name=max_concurrent_actions,json=maxConcurrentActions" json:"max_concurrent_actions,omitempty"`
+	FreeExecutionSlots   int32 `protobuf:"varint,6,opt,name=free_execution_slots,json=freeExecutionSlots" json:"free_execution_slots,omitempty"`
+	// Platform properties of the worker, such as "OSFamily" and "arch".
+	Platform map[string]string `protobuf:"bytes,7,rep,name=platform" json:"platform,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// Ways requests can be submitted, such as "sync", "async" and "batch".
+	ExecutionModes []string `protobuf:"bytes,8,rep,name=execution_modes,json=executionModes" json:"execution_modes,omitempty"`
+}
+
+func (m *WorkerCapabilities) Reset()                    { *m = WorkerCapabilities{} }
+func (m *WorkerCapabilities) String() string            { return proto.CompactTextString(m) }
+func (*WorkerCapabilities) ProtoMessage()               {}
+func (*WorkerCapabilities) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+func (m *WorkerCapabilities) GetPlatform() map[string]string {
+	if m != nil {
+		return m.Platform
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*CacheEntry)(nil), "build.remote.CacheEntry")
 	proto.RegisterType((*FileEntry)(nil), "build.remote.FileEntry")
 	proto.RegisterType((*RemoteWorkRequest)(nil), "build.remote.RemoteWorkRequest")
 	proto.RegisterType((*RemoteWorkResponse)(nil), "build.remote.RemoteWorkResponse")
+	proto.RegisterType((*Operation)(nil), "build.remote.Operation")
+	proto.RegisterType((*RemoteWorkBatchRequest)(nil), "build.remote.RemoteWorkBatchRequest")
+	proto.RegisterType((*RemoteWorkBatchResponse)(nil), "build.remote.RemoteWorkBatchResponse")
+	proto.RegisterType((*WorkerCapabilities)(nil), "build.remote.WorkerCapabilities")
+	proto.RegisterEnum("build.remote.ErrorCategory", ErrorCategory_name, ErrorCategory_value)
 }
 
 var fileDescriptor0 = []byte{
-	// 431 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x7c, 0x52, 0x4d, 0x6f, 0xd3, 0x40,
-	0x10, 0x55, 0xe2, 0xa6, 0xd4, 0xe3, 0x1c, 0xca, 0x0a, 0x09, 0x0b, 0xf1, 0x51, 0x2c, 0x04, 0xb9,
-	0xe0, 0x20, 0xb8, 0x54, 0x3d, 0x70, 0xa0, 0x6a, 0x2f, 0xdc, 0xf6, 0xc2, 0x8d, 0x60, 0x6f, 0xa7,
-	0xe9, 0xaa, 0xeb, 0x5d, 0xb3, 0x1f, 0x51, 0xf3, 0xbf, 0xf9, 0x01, 0xec, 0x87, 0x9b, 0x1a, 0x2a,
-	0xe5, 0x36, 0xf3, 0x66, 0xe6, 0xcd, 0xdb, 0x37, 0x0b, 0x1f, 0x8c, 0x66, 0xcb, 0xae, 0xe1, 0x72,
-	0xd9, 0x6b, 0x65, 0x55, 0xeb, 0xae, 0x97, 0x1a, 0x3b, 0x65, 0x71, 0x15, 0x73, 0xa6, 0x44, 0x1d,
-	0x03, 0x32, 0x6f, 0x1d, 0x17, 0x57, 0x75, 0x2a, 0x56, 0x3f, 0x01, 0xce, 0x1b, 0x76, 0x83, 0x17,
-	0xd2, 0xea, 0x2d, 0xf9, 0x08, 0xb3, 0x6b, 0x2e, 0xd0, 0x94, 0x93, 0x93, 0x6c, 0x51, 0x7c, 0x7e,
-	0x5e, 0x8f, 0x7b, 0xeb, 0x4b, 0x5f, 0x8a, 0x7d, 0x34, 0x75, 0x91, 0xb7, 0x30, 0x0f, 0xc1, 0x8a,
-	0x29, 0x69, 0x51, 0xda, 0x72, 0x7a, 0x32, 0x59, 0xcc, 0x69, 0x11, 0xb0, 0xf3, 0x04, 0x55, 0xbf,
-	0x20, 0xdf, 0x8d, 0x11, 0x02, 0x07, 0x7d, 0x63, 0x6f, 0x3c, 0xfb, 0x64, 0x91, 0xd3, 0x18, 0x93,
-	0x37, 0x50, 0x0c, 0xe3, 0xab, 0x5b, 0xdc, 0x46, 0x8a, 0x9c, 0xc2, 0x00, 0x7d, 0xc7, 0x2d, 0x79,
-	0x0d, 0x80, 0x77, 0xc8, 0x9c, 0x6d, 0x5a, 0x81, 0x65, 0xe6, 0xeb, 0x47, 0x74, 0x84, 0x54, 0x7f,
-	0xa6, 0xf0, 0x94, 0x46, 0x81, 0x3f, 0x94, 0xbe, 0xa5, 0xf8, 0xdb, 0xa1, 0xb1, 0xe4, 0x15, 0x80,
-	0x72, 0xb6, 0x77, 0x89, 0x35, 0x2d, 0xcc, 0x13, 0x12, 0x48, 0x5f, 0x42, 0xde, 0xe8, 0xb5, 0xeb,
-	0xfc, 0x0e, 0xe3, 0x77, 0x66, 0xa1, 0xba, 0x03, 0xc8, 0x29, 0x14, 0x5c, 0x86, 0xd9, 0x64, 0x46,
-	0xb6, 0xdf, 0x0c, 0x88, 0xbd, 0x97, 0xd1, 0x11, 0x0a, 0x05, 0xca, 0x0d, 0xd7, 0x4a, 0x06, 0xa6,
-	0xf2, 0x20, 0x4e, 0x7e, 0xfa, 0x77, 0xf2, 0x91, 0xd8, 0xfa, 0xe2, 0x61, 0x24, 0x51, 0x8e, 0x49,
-	0xc8, 0x19, 0xcc, 0x87, 0xa7, 0x24, 0x39, 0xb3, 0xfd, 0x72, 0x8a, 0xd4, 0x9c, 0xf4, 0x94, 0xf0,
-	0xc4, 0xf2, 0x0e, 0x3d, 0x54, 0x1e, 0x7a, 0x0f, 0x66, 0xf4, 0x3e, 0x7d, 0xf1, 0x15, 0x8e, 0xff,
-	0x5f, 0x4b, 0x8e, 0x21, 0x7b, 0x70, 0x2b, 0x84, 0xe4, 0x19, 0xcc, 0x36, 0x8d, 0x70, 0x38, 0xdc,
-	0x25, 0x25, 0x67, 0xd3, 0xd3, 0x49, 0xd5, 0x03, 0x19, 0x3f, 0xc4, 0xf4, 0x4a, 0x1a, 0x0c, 0xfb,
-	0x8c, 0x63, 0x0c, 0x8d, 0x89, 0x2c, 0x47, 0xf4, 0x3e, 0x0d, 0xdc, 0x41, 0x45, 0xe2, 0x09, 0x61,
-	0x40, 0x50, 0xeb, 0x78, 0x51, 0x8f, 0xf8, 0x30, 0x5c, 0x05, 0xef, 0x18, 0xf6, 0x96, 0x2b, 0xe9,
-	0xbd, 0x8b, 0x37, 0xdb, 0x01, 0xdf, 0xde, 0xc3, 0x3b, 0xa6, 0xba, 0x7a, 0xad, 0xd4, 0x5a, 0x60,
-	0x7d, 0x85, 0x1b, 0xab, 0x94, 0x30, 0x83, 0x0d, 0x82, 0xb7, 0x83, 0x15, 0xed, 0x61, 0xfc, 0xe7,
-	0x5f, 0xfe, 0x06, 0x00, 0x00, 0xff, 0xff, 0x83, 0x30, 0x2e, 0x0a, 0x12, 0x03, 0x00, 0x00,
+	// 1045 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x55, 0xdd, 0x6e, 0xdb, 0x46,
+	0x13, 0xfd, 0x68, 0x49, 0xb6, 0x38, 0xb2, 0x64, 0x7a, 0x3f, 0x23, 0x21, 0xd2, 0x9f, 0xa8, 0x6a,
+	0xd1, 0xa8, 0x69, 0xa3, 0x04, 0x69, 0x2f, 0x82, 0xa4, 0x28, 0xa0, 0xc8, 0x74, 0xc1, 0xd6, 0x96,
+	0xd2, 0xb5, 0xe4, 0xde, 0x95, 0xa5, 0xa8, 0xb1, 0x4c, 0x98, 0xe4, 0xaa, 0xbb, 0x4b, 0x43, 0x7a,
+	0x83, 0x5e, 0xf5, 0xa2, 0x57, 0x7d, 0x81, 0x3e, 0x56, 0xdf, 0xa5, 0xd8, 0x5d, 0xea, 0x2f, 0x46,
+	0x12, 0x14, 0xb9, 0x9b, 0x3d, 0x33, 0x73, 0x76, 0x76, 0xe6, 0x70, 0x08, 0x0f, 0x04, 0x8f, 0x1e,
+	0xa7, 0x61, 0x9c, 0x3d, 0x9e, 0x71, 0x26, 0xd9, 0x38, 0xbf, 0x7c, 0xcc, 0x31, 0x65, 0x12, 0x03,
+	0x7d, 0x8e, 0x58, 0xd2, 0xd1, 0x06, 0xd9, 0x1f, 0xe7, 0x71, 0x32, 0xe9, 0x18, 0x67, 0xeb, 0x17,
+	0x80, 0x5e, 0x18, 0x5d, 0xa1, 0x97, 0x49, 0xbe, 0x20, 0x8f, 0xa0, 0x72, 0x19, 0x27, 0x28, 0x5c,
+	0xab, 0x59, 0x6a, 0xd7, 0x9e, 0xde, 0xed, 0x6c, 0xc6, 0x76, 0x4e, 0xe2, 0xc4, 0xc4, 0x51, 0x13,
+	0x45, 0x3e, 0x81, 0x7d, 0x65, 0x04, 0x11, 0xcb, 0x24, 0x66, 0xd2, 0xdd, 0x69, 0x5a, 0xed, 0x7d,
+	0x5a, 0x53, 0x58, 0xcf, 0x40, 0xad, 0x5f, 0xc1, 0x5e, 0xa5, 0x11, 0x02, 0xe5, 0x59, 0x28, 0xaf,
+	0x5c, 0xab, 0x69, 0xb5, 0x6d, 0xaa, 0x6d, 0x72, 0x1f, 0x6a, 0x45, 0x7a, 0x70, 0x8d, 0x0b, 0x4d,
+	0x61, 0x53, 0x28, 0xa0, 0x1f, 0x71, 0x41, 0x3e, 0x06, 0xc0, 0x39, 0x46, 0xb9, 0x0c, 0xc7, 0x09,
+	0xba, 0xa5, 0xa6, 0xd5, 0xae, 0xd2, 0x0d, 0xa4, 0xf5, 0x77, 0x19, 0x0e, 0xa9, 0x2e, 0xf0, 0x67,
+	0xc6, 0xaf, 0x29, 0xfe, 0x96, 0xa3, 0x90, 0xe4, 0x23, 0x00, 0x96, 0xcb, 0x59, 0x6e, 0x58, 0xcd,
+	0x85, 0xb6, 0x41, 0x14, 0xe9, 0x87, 0x60, 0x87, 0x7c, 0x9a, 0xa7, 0x98, 0x49, 0xe1, 0xee, 0x34,
+	0x4b, 0xca, 0xbb, 0x02, 0xc8, 0x33, 0xa8, 0xc5, 0x99, 0xca, 0x35, 0xcd, 0x28, 0xbd, 0xbd, 0x19,
+	0xa0, 0x63, 0x4f, 0x74, 0x47, 0x28, 0xd4, 0x30, 0xbb, 0x89, 0x39, 0xcb, 0x14, 0x93, 0x5b, 0xd6,
+	0x99, 0x4f, 0xb6, 0x33, 0x6f, 0x15, 0xdb, 0xf1, 0xd6, 0x29, 0x86, 0x72, 0x93, 0x84, 0x3c, 0x87,
+	0xfd, 0xe2, 0x29, 0xa6, 0x9c, 0xca, 0xdb, 0xcb, 0xa9, 0x99, 0x60, 0x53, 0x8f, 0x0b, 0x7b, 0x32,
+	0x4e, 0x91, 0xe5, 0xd2, 0xdd, 0x6d, 0x5a, 0xed, 0x0a, 0x5d, 0x1e, 0xc9, 0x03, 0x38, 0x98, 0xc4,
+	0x53, 0x14, 0x32, 0xb8, 0xcc, 0xb3, 0x48, 0xc6, 0x2c, 0x73, 0xf7, 0x74, 0x97, 0x1a, 0x06, 0x3e,
+	0x29, 0x50, 0xe2, 0x43, 0x75, 0x96, 0x84, 0xf2, 0x92, 0xf1, 0xd4, 0xad, 0xea, 0xab, 0x1f, 0xbd,
+	0xeb, 0x3d, 0xaf, 0x8a, 0x78, 0x53, 0xd0, 0x2a, 0xfd, 0xde, 0x77, 0xe0, 0xbc, 0xfe, 0x54, 0xe2,
+	0x40, 0x69, 0x3d, 0x21, 0x65, 0x92, 0x23, 0xa8, 0xdc, 0x84, 0x49, 0x8e, 0x85, 0x16, 0xcc, 0xe1,
+	0xf9, 0xce, 0x33, 0xeb, 0xde, 0x0b, 0xa8, 0x6f, 0x51, 0xff, 0x97, 0xe4, 0xd6, 0xef, 0x25, 0x20,
+	0x9b, 0xa5, 0x8a, 0x19, 0xcb, 0x04, 0xaa, 0x0e, 0x89, 0x3c, 0x8a, 0x50, 0x08, 0x4d, 0x53, 0xa5,
+	0xcb, 0xa3, 0x22, 0x57, 0x7d, 0x33, 0x44, 0xca, 0x54, 0x08, 0x72, 0xae, 0x35, 0x68, 0x53, 0x65,
+	0x2a, 0x1d, 0xe1, 0x3c, 0xc2, 0x99, 0xee, 0x5f, 0xd9, 0xa8, 0x6c, 0x05, 0x90, 0xaf, 0x80, 0xa4,
+	0xb1, 0x10, 0x71, 0x36, 0x0d, 0x8c, 0x9e, 0xae, 0x71, 0x61, 0xe6, 0x67, 0x53, 0xa7, 0xf0, 0xf8,
+	0x99, 0x91, 0xa4, 0x50, 0x5c, 0x1c, 0x25, 0x5f, 0x68, 0x9d, 0xef, 0xea, 0x5a, 0xd6, 0x80, 0x12,
+	0xb4, 0x90, 0x13, 0x56, 0x08, 0xda, 0x8c, 0xca, 0x36, 0x88, 0x12, 0xb4, 0x71, 0x23, 0xe7, 0xda,
+	0x5d, 0x5d, 0xb9, 0x91, 0x73, 0xe5, 0xfe, 0x14, 0xea, 0x2a, 0x55, 0xf2, 0x3c, 0x8b, 0x42, 0x89,
+	0x13, 0xd7, 0xd6, 0xfc, 0x4a, 0x58, 0xc3, 0x25, 0xa6, 0x82, 0x14, 0xc1, 0x3a, 0x08, 0x4c, 0x10,
+	0x72, 0xbe, 0x0e, 0x7a, 0x09, 0x0d, 0xe4, 0x9c, 0xf1, 0x40, 0x1d, 0xa7, 0x8c, 0x2f, 0xdc, 0x5a,
+	0xd3, 0x6a, 0x37, 0x9e, 0x7e, 0xb0, 0x2d, 0x0a, 0x4f, 0xc5, 0xf4, 0x8a, 0x10, 0x5a, 0xc7, 0xcd,
+	0x63, 0xeb, 0x4f, 0x0b, 0xec, 0xc1, 0x0c, 0x79, 0xa8, 0xbb, 0x44, 0xa0, 0x9c, 0x85, 0x29, 0x2e,
+	0xb7, 0x82, 0xb2, 0x15, 0x36, 0x61, 0x99, 0x99, 0x62, 0x95, 0x6a, 0x9b, 0x7c, 0x0b, 0x55, 0x5e,
+	0x4c, 0x4d, 0x8f, 0xa0, 0xf6, 0xb4, 0xf9, 0x66, 0x21, 0x9a, 0x38, 0xba, 0xca, 0x50, 0x7b, 0x46,
+	0xc8, 0x50, 0xe6, 0x22, 0x88, 0xd8, 0x04, 0xf5, 0xac, 0x2a, 0x14, 0x0c, 0xd4, 0x63, 0x13, 0x6c,
+	0x8d, 0xe0, 0xce, 0x9a, 0xe0, 0x65, 0x28, 0xa3, 0xab, 0xe5, 0x2e, 0x79, 0xa1, 0x2e, 0xd6, 0xe6,
+	0x72, 0x31, 0xde, 0x7f, 0xc7, 0x17, 0x40, 0x57, 0x09, 0xad, 0x3f, 0x2c, 0xb8, 0x7b, 0x8b, 0xb7,
+	0xa8, 0xe9, 0x08, 0x2a, 0x71, 0x36, 0xc1, 0xb9, 0x7e, 0x7a, 0x85, 0x9a, 0xc3, 0xd6, 0x3b, 0x77,
+	0xde, 0xf7, 0x9d, 0xa5, 0x5b, 0xef, 0xfc, 0xa7, 0x04, 0x44, 0xe5, 0x22, 0xef, 0x85, 0xb3, 0x70,
+	0x1c, 0x27, 0xb1, 0x8c, 0x51, 0x90, 0x2f, 0xc0, 0x59, 0xfe, 0x28, 0x82, 0x1b, 0xe4, 0x42, 0x09,
+	0xda, 0x94, 0x75, 0xb0, 0xc4, 0x2f, 0x0c, 0xac, 0x42, 0x5f, 0x5b, 0x1d, 0xcb, 0x1d, 0x7a, 0xb0,
+	0xbd, 0x3b, 0x04, 0xf9, 0x12, 0x0e, 0x23, 0xf5, 0x7b, 0x09, 0x22, 0x96, 0xce, 0x38, 0x0a, 0x4d,
+	0x6b, 0xbe, 0x1f, 0x47, 0x3b, 0x7a, 0x6b, 0x9c, 0x3c, 0x84, 0xc3, 0x34, 0x9c, 0x07, 0x71, 0x96,
+	0xc4, 0x19, 0x06, 0x66, 0x8d, 0xe9, 0x41, 0x95, 0xe8, 0x41, 0x1a, 0xce, 0x7d, 0x8d, 0x0f, 0x34,
+	0x4c, 0xbe, 0x81, 0x3b, 0x2a, 0x36, 0x62, 0x59, 0x94, 0x73, 0xae, 0xfe, 0x1e, 0x61, 0x51, 0x49,
+	0x45, 0x17, 0x7d, 0x94, 0x86, 0xf3, 0xde, 0xca, 0xd9, 0x2d, 0xca, 0x79, 0x02, 0x47, 0x97, 0x1c,
+	0x31, 0x30, 0xbf, 0x8f, 0x98, 0x65, 0x81, 0x48, 0x98, 0x14, 0xc5, 0x6e, 0x24, 0xca, 0xe7, 0x2d,
+	0x5d, 0xe7, 0xca, 0x43, 0x7e, 0xd8, 0xd8, 0x7e, 0x7b, 0x7a, 0xf6, 0x9d, 0xed, 0x61, 0xdc, 0x6e,
+	0xe5, 0x9b, 0xd6, 0x9f, 0x5a, 0xb9, 0xeb, 0x8b, 0x53, 0x36, 0x41, 0xa1, 0x17, 0xaa, 0x4d, 0x1b,
+	0x2b, 0xf8, 0x4c, 0xa1, 0xef, 0xb5, 0xe7, 0x1e, 0xfe, 0x65, 0x41, 0x7d, 0xeb, 0xeb, 0x23, 0xfb,
+	0x50, 0xed, 0x0f, 0x02, 0x8f, 0xd2, 0x01, 0x75, 0xfe, 0x47, 0x0e, 0xa1, 0xde, 0xed, 0x0d, 0xfd,
+	0x41, 0x3f, 0x38, 0xe9, 0xfa, 0xa7, 0xde, 0xb1, 0x63, 0x29, 0xe8, 0xcc, 0x3f, 0x3f, 0xf7, 0xfb,
+	0xdf, 0x07, 0x7e, 0xff, 0xd5, 0x68, 0xe8, 0xec, 0x10, 0x02, 0x0d, 0xbf, 0x7f, 0x42, 0xbb, 0xe7,
+	0x43, 0x3a, 0xea, 0x0d, 0x47, 0xd4, 0x73, 0x4a, 0xa4, 0x06, 0x7b, 0x43, 0xff, 0xcc, 0x1b, 0x8c,
+	0x86, 0x4e, 0x99, 0x34, 0x00, 0x06, 0x17, 0x1e, 0x3d, 0x1d, 0x74, 0x8f, 0xbd, 0x63, 0xa7, 0x42,
+	0xfe, 0x0f, 0x07, 0x7e, 0xff, 0xa2, 0x7b, 0xea, 0x1f, 0x07, 0xd4, 0xfb, 0x69, 0xe4, 0x9d, 0x0f,
+	0x9d, 0x5d, 0x52, 0x07, 0xbb, 0xd7, 0xed, 0xf7, 0xbc, 0x53, 0x75, 0xcf, 0xde, 0xcb, 0xcf, 0xe1,
+	0xb3, 0x88, 0xa5, 0x9d, 0x29, 0x63, 0xd3, 0x04, 0x3b, 0x13, 0xbc, 0x91, 0x8c, 0x25, 0xa2, 0xe8,
+	0x67, 0x12, 0x8f, 0x8b, 0x9e, 0x8e, 0x77, 0xb5, 0xe2, 0xbe, 0xfe, 0x77, 0x00, 0xb1, 0xd2, 0x48,
+	0xf1, 0xd4, 0x08, 0x00, 0x00,
 }